@@ -0,0 +1,93 @@
+package access
+
+import (
+	"errors"
+	"recognizer/db"
+	"recognizer/types"
+
+	"gorm.io/gorm"
+)
+
+// Exams the user can't see are not found for them, so their existence doesn't leak
+var ErrExamNotFound = errors.New("Exam not found")
+
+var roleRanks = map[string]int{
+	types.RoleViewer: 1,
+	types.RoleEditor: 2,
+	types.RoleOwner:  3,
+}
+
+// Role returns the role of the user in the exam, empty when they aren't a member.
+// The creator of the exam is always an owner, invitations count once they are accepted.
+func Role(tx *gorm.DB, exam *db.Exam, userId uint) (string, error) {
+	if exam.UserID == userId {
+		return types.RoleOwner, nil
+	}
+
+	var member db.ExamMember
+	err := tx.Where("exam_id = ? AND user_id = ? AND accepted_at IS NOT NULL", exam.ID, userId).First(&member).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil
+	}
+
+	return member.Role, err
+}
+
+// Can tells whether the user has the role in the exam or one above it
+func Can(tx *gorm.DB, exam *db.Exam, userId uint, role string) (bool, error) {
+	userRole, err := Role(tx, exam, userId)
+	if err != nil {
+		return false, err
+	}
+
+	return roleRanks[userRole] >= roleRanks[role], nil
+}
+
+// CanView tells whether the user can see and play the exam.
+// Members see it whatever its visibility, everyone sees public exams and unlisted ones need a share link the user opened that wasn't revoked since.
+func CanView(tx *gorm.DB, exam *db.Exam, userId uint) (bool, error) {
+	if exam.Visibility == types.VisibilityPublic {
+		return true, nil
+	}
+
+	member, err := Can(tx, exam, userId, types.RoleViewer)
+	if err != nil || member {
+		return member, err
+	}
+
+	if exam.Visibility != types.VisibilityUnlisted {
+		return false, nil
+	}
+
+	var shares int64
+	err = tx.Model(&db.ExamShare{}).
+		Joins("INNER JOIN share_links ON share_links.id = exam_shares.share_link_id AND share_links.deleted_at IS NULL").
+		Where("exam_shares.user_id = ? AND exam_shares.exam_id = ? AND share_links.revoked_at IS NULL", userId, exam.ID).
+		Count(&shares).Error
+
+	return shares > 0, err
+}
+
+// FindExam loads the exam if the user can see it
+func FindExam(tx *gorm.DB, examId uint, userId uint) (*db.Exam, error) {
+	var exam db.Exam
+	err := tx.First(&exam, examId).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrExamNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	visible, err := CanView(tx, &exam, userId)
+	if err != nil {
+		return nil, err
+	}
+	if !visible {
+		return nil, ErrExamNotFound
+	}
+
+	return &exam, nil
+}
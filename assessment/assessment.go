@@ -0,0 +1,390 @@
+package assessment
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"net/http"
+	"recognizer/access"
+	"recognizer/db"
+	"recognizer/game"
+	"recognizer/types"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	errAttemptNotFound  = errors.New("Attempt not found")
+	errAttemptLocked    = errors.New("Attempt is already locked")
+	errAttemptExpired   = errors.New("Time for this attempt has run out")
+	errQuestionNotFound = errors.New("Question not found")
+	errAnswerNotOffered = errors.New("This answer is not offered in the question")
+)
+
+type Service struct {
+	types.ServiceConfig
+}
+
+func NewAssessmentService(config types.ServiceConfig) Service {
+	return Service{config}
+}
+
+// StartAttempt generates the questions of a new attempt, an attempt still running is returned instead
+func (service *Service) StartAttempt(c *gin.Context) {
+	examIdParam, err := strconv.ParseUint(c.Param("examId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	foundExam, err := access.FindExam(service.DB, uint(examIdParam), c.MustGet("userId").(uint))
+	if errors.Is(err, access.ErrExamNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading exam"})
+		return
+	}
+
+	userId := c.MustGet("userId").(uint)
+	now := time.Now()
+
+	var running db.Attempt
+	res := service.DB.
+		Preload("Questions", func(tx *gorm.DB) *gorm.DB { return tx.Order("position") }).
+		Where("user_id = ? AND exam_id = ? AND submitted_at IS NULL AND deadline_at > ?", userId, foundExam.ID, now).
+		First(&running)
+	if res.Error == nil {
+		c.JSON(http.StatusOK, newAttemptView(&running))
+		return
+	}
+
+	var items []*db.Item
+	service.DB.Where("exam_id = ?", foundExam.ID).Find(&items)
+
+	if len(items) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No items in this exam"})
+		return
+	}
+
+	// Every item is asked at most once
+	rand.Shuffle(len(items), func(i, j int) { items[i], items[j] = items[j], items[i] })
+	count := len(items)
+	if foundExam.AssessmentSize > 0 {
+		count = min(foundExam.AssessmentSize, len(items))
+	}
+
+	attempt := db.Attempt{
+		UserID:     userId,
+		ExamID:     foundExam.ID,
+		DeadlineAt: now.Add(time.Duration(foundExam.AssessmentTimeLimit) * time.Minute),
+		Total:      count,
+	}
+
+	source := game.QuestionSource{Exam: foundExam, Items: items}
+	for position, item := range items[:count] {
+		question := game.NewQuestion(source, item)
+		attempt.Questions = append(attempt.Questions, db.AttemptQuestion{
+			Position:      position,
+			ItemID:        item.ID,
+			Image:         item.Image,
+			Answers:       question.Answers,
+			CorrectAnswer: item.Name,
+		})
+	}
+
+	if err := service.DB.Create(&attempt).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating attempt"})
+		return
+	}
+
+	c.JSON(http.StatusOK, newAttemptView(&attempt))
+}
+
+func (service *Service) GetAttempt(c *gin.Context) {
+	attempt, err := service.loadAttempt(c)
+	if err != nil {
+		return
+	}
+
+	c.JSON(http.StatusOK, newAttemptView(attempt))
+}
+
+// AnswerQuestion sets or changes the answer to a question of an attempt that is still running
+func (service *Service) AnswerQuestion(c *gin.Context) {
+	attemptIdParam, err := strconv.ParseUint(c.Param("attemptId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	position, err := strconv.Atoi(c.Param("position"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var data types.AnswerAttemptQuestion
+
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userId := c.MustGet("userId").(uint)
+
+	err = service.DB.Transaction(func(tx *gorm.DB) error {
+		// Locking the attempt keeps answers from slipping in while it is being submitted
+		attempt, err := lockAttempt(tx, uint(attemptIdParam), userId, time.Now())
+		if err != nil {
+			return err
+		}
+
+		var question db.AttemptQuestion
+		res := tx.Where("attempt_id = ? AND position = ?", attempt.ID, position).First(&question)
+		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return errQuestionNotFound
+		}
+		if res.Error != nil {
+			return res.Error
+		}
+
+		if data.Answer != "" && !offered(question.Answers, data.Answer) {
+			return errAnswerNotOffered
+		}
+
+		now := time.Now()
+		return tx.Model(&question).Updates(map[string]interface{}{"answer": data.Answer, "answered_at": &now}).Error
+	})
+
+	switch {
+	case errors.Is(err, errAttemptNotFound), errors.Is(err, errQuestionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, errAttemptExpired):
+		service.expireAttempt(uint(attemptIdParam))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, errAttemptLocked), errors.Is(err, errAnswerNotOffered):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving answer"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"position": position, "answer": data.Answer})
+}
+
+// SubmitAttempt locks and grades the attempt
+func (service *Service) SubmitAttempt(c *gin.Context) {
+	attemptIdParam, err := strconv.ParseUint(c.Param("attemptId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userId := c.MustGet("userId").(uint)
+
+	err = service.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		attempt, err := lockAttempt(tx, uint(attemptIdParam), userId, now)
+		if err != nil {
+			return err
+		}
+
+		return gradeAttempt(tx, attempt, now, false)
+	})
+
+	// An attempt out of time is locked with the answers given in time
+	if errors.Is(err, errAttemptExpired) {
+		err = service.expireAttempt(uint(attemptIdParam))
+	}
+
+	switch {
+	case errors.Is(err, errAttemptNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, errAttemptLocked):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error submitting attempt"})
+		return
+	}
+
+	attempt, err := service.findAttempt(uint(attemptIdParam), userId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading attempt"})
+		return
+	}
+
+	c.JSON(http.StatusOK, newAttemptView(attempt))
+}
+
+// loadAttempt loads the attempt from the URL and writes the error response when it can't
+func (service *Service) loadAttempt(c *gin.Context) (*db.Attempt, error) {
+	attemptIdParam, err := strconv.ParseUint(c.Param("attemptId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, err
+	}
+
+	attempt, err := service.findAttempt(uint(attemptIdParam), c.MustGet("userId").(uint))
+	if errors.Is(err, errAttemptNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return nil, err
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading attempt"})
+		return nil, err
+	}
+
+	return attempt, nil
+}
+
+// findAttempt loads the attempt of the user with its questions, an attempt out of time gets locked first
+func (service *Service) findAttempt(attemptId uint, userId uint) (*db.Attempt, error) {
+	var attempt *db.Attempt
+	res := service.DB.
+		Preload("Questions", func(tx *gorm.DB) *gorm.DB { return tx.Order("position") }).
+		Where("user_id = ?", userId).
+		First(&attempt, attemptId)
+
+	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		return nil, errAttemptNotFound
+	}
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	if attempt.SubmittedAt == nil && !time.Now().Before(attempt.DeadlineAt) {
+		if err := service.expireAttempt(attempt.ID); err != nil {
+			return nil, err
+		}
+		return service.findAttempt(attemptId, userId)
+	}
+
+	return attempt, nil
+}
+
+// expireAttempt locks and grades an attempt that ran out of time
+func (service *Service) expireAttempt(attemptId uint) error {
+	return service.DB.Transaction(func(tx *gorm.DB) error {
+		var attempt db.Attempt
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&attempt, attemptId).Error
+		if err != nil {
+			return err
+		}
+
+		// Someone else may have locked it in the meantime
+		if attempt.SubmittedAt != nil {
+			return nil
+		}
+
+		return gradeAttempt(tx, &attempt, attempt.DeadlineAt, true)
+	})
+}
+
+// lockAttempt locks the row of an attempt that can still be changed
+func lockAttempt(tx *gorm.DB, attemptId uint, userId uint, now time.Time) (*db.Attempt, error) {
+	var attempt db.Attempt
+	res := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ?", userId).First(&attempt, attemptId)
+
+	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		return nil, errAttemptNotFound
+	}
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	if attempt.SubmittedAt != nil {
+		return nil, errAttemptLocked
+	}
+
+	if !now.Before(attempt.DeadlineAt) {
+		return nil, errAttemptExpired
+	}
+
+	return &attempt, nil
+}
+
+// gradeAttempt grades the answers and locks the attempt, the attempt row has to be locked already
+func gradeAttempt(tx *gorm.DB, attempt *db.Attempt, submittedAt time.Time, timedOut bool) error {
+	var questions []db.AttemptQuestion
+	if err := tx.Where("attempt_id = ?", attempt.ID).Find(&questions).Error; err != nil {
+		return err
+	}
+
+	correct := 0
+	for _, question := range questions {
+		isCorrect := question.Answer != "" && question.Answer == question.CorrectAnswer
+		if isCorrect {
+			correct++
+		}
+
+		if err := tx.Model(&question).Update("correct", isCorrect).Error; err != nil {
+			return err
+		}
+	}
+
+	score := 0
+	if len(questions) > 0 {
+		score = int(math.Round(float64(correct) / float64(len(questions)) * 100))
+	}
+
+	return tx.Model(attempt).Updates(map[string]interface{}{
+		"submitted_at": submittedAt,
+		"timed_out":    timedOut,
+		"correct":      correct,
+		"total":        len(questions),
+		"score":        score,
+	}).Error
+}
+
+func offered(answers []string, answer string) bool {
+	for _, offered := range answers {
+		if offered == answer {
+			return true
+		}
+	}
+
+	return false
+}
+
+func newAttemptView(attempt *db.Attempt) types.AttemptView {
+	view := types.AttemptView{
+		AttemptId:   attempt.ID,
+		ExamId:      attempt.ExamID,
+		StartedAt:   attempt.CreatedAt,
+		DeadlineAt:  attempt.DeadlineAt,
+		SubmittedAt: attempt.SubmittedAt,
+		Locked:      attempt.SubmittedAt != nil,
+		TimedOut:    attempt.TimedOut,
+		Questions:   []types.AttemptQuestionView{},
+	}
+
+	for _, question := range attempt.Questions {
+		view.Questions = append(view.Questions, types.AttemptQuestionView{
+			Position: question.Position,
+			Image:    question.Image,
+			Answers:  question.Answers,
+			Answer:   question.Answer,
+		})
+	}
+
+	if view.Locked {
+		view.Result = &types.AttemptResult{
+			Correct: attempt.Correct,
+			Total:   attempt.Total,
+			Score:   attempt.Score,
+		}
+	}
+
+	return view
+}
@@ -0,0 +1,131 @@
+package assessment
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"recognizer/access"
+	"recognizer/db"
+	"recognizer/types"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ListAttempts lists the attempts at the assessment of the exam for its owners, newest first
+func (service *Service) ListAttempts(c *gin.Context) {
+	examIdParam, err := strconv.ParseUint(c.Param("examId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var foundExam *db.Exam
+	res := service.DB.First(&foundExam, uint(examIdParam))
+
+	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Exam not found"})
+		return
+	}
+
+	if allowed, err := access.Can(service.DB, foundExam, c.MustGet("userId").(uint), types.RoleOwner); err != nil || !allowed {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	// Attempts nobody came back to after the time ran out are graded now
+	var expiredIds []uint
+	service.DB.Model(&db.Attempt{}).
+		Where("exam_id = ? AND submitted_at IS NULL AND deadline_at <= ?", foundExam.ID, time.Now()).
+		Pluck("id", &expiredIds)
+	for _, attemptId := range expiredIds {
+		if err := service.expireAttempt(attemptId); err != nil {
+			fmt.Println(err.Error())
+		}
+	}
+
+	var data []types.AttemptSummary
+	err = service.DB.Model(&db.Attempt{}).
+		Select("attempts.id as attempt_id, attempts.user_id, users.username, attempts.created_at as started_at, "+
+			"attempts.submitted_at, attempts.timed_out, attempts.correct, attempts.total, attempts.score").
+		Joins("INNER JOIN users ON attempts.user_id = users.id").
+		Where("attempts.exam_id = ?", foundExam.ID).
+		Order("attempts.created_at DESC").
+		Scan(&data).Error
+
+	if err != nil {
+		fmt.Println(err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error querying database"})
+		return
+	}
+
+	c.JSON(http.StatusOK, data)
+}
+
+// GetAttemptReport shows the owners of the exam every question of an attempt with the answer given
+func (service *Service) GetAttemptReport(c *gin.Context) {
+	attemptIdParam, err := strconv.ParseUint(c.Param("attemptId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var attempt *db.Attempt
+	res := service.DB.First(&attempt, uint(attemptIdParam))
+
+	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": errAttemptNotFound.Error()})
+		return
+	}
+
+	var foundExam *db.Exam
+	service.DB.First(&foundExam, attempt.ExamID)
+
+	if allowed, err := access.Can(service.DB, foundExam, c.MustGet("userId").(uint), types.RoleOwner); err != nil || !allowed {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	// Only locked attempts have their answers graded
+	attempt, err = service.findAttempt(attempt.ID, attempt.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading attempt"})
+		return
+	}
+
+	var user db.User
+	service.DB.First(&user, attempt.UserID)
+
+	report := types.AttemptReport{
+		AttemptSummary: types.AttemptSummary{
+			AttemptId:   attempt.ID,
+			UserId:      attempt.UserID,
+			Username:    user.Username,
+			StartedAt:   attempt.CreatedAt,
+			SubmittedAt: attempt.SubmittedAt,
+			TimedOut:    attempt.TimedOut,
+			Correct:     attempt.Correct,
+			Total:       attempt.Total,
+			Score:       attempt.Score,
+		},
+		DeadlineAt: attempt.DeadlineAt,
+		Questions:  []types.AttemptReportQuestion{},
+	}
+
+	for _, question := range attempt.Questions {
+		report.Questions = append(report.Questions, types.AttemptReportQuestion{
+			Position:      question.Position,
+			ItemId:        question.ItemID,
+			Image:         question.Image,
+			Answers:       question.Answers,
+			CorrectAnswer: question.CorrectAnswer,
+			Answer:        question.Answer,
+			AnsweredAt:    question.AnsweredAt,
+			Correct:       question.Correct,
+		})
+	}
+
+	c.JSON(http.StatusOK, report)
+}
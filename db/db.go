@@ -22,7 +22,9 @@ type Group struct {
 	Name   string `json:"name" binding:"required"`
 	ExamID uint   `json:"examId" binding:"required"`
 	Items  []Item `json:"items"`
-	Exam Exam
+	Exam   Exam
+	// Group of the source exam this one was cloned from
+	SourceGroupID *uint `json:"sourceGroupId"`
 }
 
 type Exam struct {
@@ -31,45 +33,292 @@ type Exam struct {
 	Groups []Group `json:"groups"`
 	Items  []Item  `json:"items"`
 	UserID uint
+	// Grading of typed answers
+	MaxTypos         int  `json:"maxTypos" gorm:"default:1"`
+	StrictCase       bool `json:"strictCase"`
+	StrictDiacritics bool `json:"strictDiacritics"`
+	// Seconds to answer a question, zero means no limit
+	QuestionTimeLimit int `json:"questionTimeLimit"`
+	// Speed bonus switch of exams from before scoring rules, only read to migrate them
+	SpeedBonus bool `json:"-"`
+	// Number of answers offered in a question, including the correct one
+	AnswerCount int `json:"answerCount" gorm:"default:4"`
+	// Weights of the question types questions are picked from, nil asks multiple choice only
+	QuestionTypes map[string]int `json:"questionTypes" gorm:"serializer:json"`
+	// Questions and minutes of a formal assessment
+	AssessmentSize      int `json:"assessmentSize" gorm:"default:20"`
+	AssessmentTimeLimit int `json:"assessmentTimeLimit" gorm:"default:30"`
+	// Current scoring rules and their version, zero for exams that weren't migrated yet
+	Scoring        ScoringRules `json:"scoring" gorm:"serializer:json"`
+	ScoringVersion int          `json:"scoringVersion"`
+	// Who can see and play the exam, exams from before were listed to everyone
+	Visibility string `json:"visibility" gorm:"default:public"`
+	// Exam this one was cloned from
+	SourceExamID *uint `json:"sourceExamId" gorm:"index"`
+}
+
+// ShareLink lets the users who open it see an unlisted exam until it is revoked
+type ShareLink struct {
+	BaseModel
+	ExamID    uint       `gorm:"index" json:"examId"`
+	Token     string     `gorm:"uniqueIndex" json:"token"`
+	UserID    uint       `json:"userId"`
+	RevokedAt *time.Time `json:"revokedAt"`
+}
+
+// ExamMember gives a user a role in an exam once they accept the invitation, the creator of the exam is an owner without one
+type ExamMember struct {
+	BaseModel
+	ExamID    uint   `gorm:"uniqueIndex:idx_member_exam_user" json:"examId"`
+	UserID    uint   `gorm:"uniqueIndex:idx_member_exam_user" json:"userId"`
+	Role      string `json:"role"`
+	InvitedBy uint   `json:"invitedBy"`
+	// Nil while the invitation is pending
+	AcceptedAt *time.Time `json:"acceptedAt"`
+}
+
+// ExamShare records a user who opened a share link
+type ExamShare struct {
+	BaseModel
+	UserID      uint `gorm:"uniqueIndex:idx_share_user_link"`
+	ShareLinkID uint `gorm:"uniqueIndex:idx_share_user_link"`
+	ExamID      uint `gorm:"index"`
+}
+
+// ScoringRules decide the points of an answer, answers keep the points they got under the rules of their time
+type ScoringRules struct {
+	CorrectPoints int `json:"correctPoints"`
+	WrongPenalty  int `json:"wrongPenalty"`
+	// Every player starts a leaderboard with these points
+	BaseScore int `json:"baseScore"`
+	// Most points an instant correct answer earns for speed, zero turns the bonus off
+	SpeedBonus int `json:"speedBonus"`
+	// Points for each correct answer in a row before a correct one, up to MaxStreakBonus unless that is zero
+	StreakBonus    int `json:"streakBonus"`
+	MaxStreakBonus int `json:"maxStreakBonus"`
+	// Points taken from a correct answer for each hint used on it
+	HintPenalty int `json:"hintPenalty"`
+	// Leaderboard scores don't go below zero
+	FloorAtZero bool `json:"floorAtZero"`
+}
+
+// DefaultScoringRules are the rules every exam was scored by before they could be changed
+var DefaultScoringRules = ScoringRules{
+	CorrectPoints: 10,
+	WrongPenalty:  5,
+	BaseScore:     100,
+	HintPenalty:   3,
+}
+
+// Speed bonus of the exams that had it switched on before scoring rules
+const legacySpeedBonus = 5
+
+// ScoringPolicy is one version of the scoring rules of an exam, a version is added whenever the rules change
+type ScoringPolicy struct {
+	BaseModel
+	ExamID  uint         `gorm:"uniqueIndex:idx_policy_exam_version" json:"examId"`
+	Version int          `gorm:"uniqueIndex:idx_policy_exam_version" json:"version"`
+	Rules   ScoringRules `gorm:"serializer:json" json:"rules"`
 }
 
 type Item struct {
 	BaseModel
-	Name    string `json:"name" binding:"required"`
-	Image   string `json:"image"`
-	GroupID uint   `json:"groupId"`
-	ExamID  uint   `json:"examId"`
-	Exam Exam
+	Name  string `json:"name" binding:"required"`
+	Image string `json:"image"`
+	// Other names accepted as typed answers
+	Aliases []string `json:"aliases" gorm:"serializer:json"`
+	GroupID uint     `json:"groupId"`
+	ExamID  uint     `json:"examId"`
+	Exam    Exam
+	// Elo difficulty, higher is harder
+	Rating float64 `json:"rating" gorm:"default:1500"`
+	// Image is the first of the images, items created before there could be more only have Image
+	Images []ItemImage `json:"images"`
+	// Kind of the media in Image and Images, all of them are of the same kind
+	MediaType string `json:"mediaType" gorm:"default:image"`
+	// Item of the source exam this one was cloned from
+	SourceItemID *uint `json:"sourceItemId"`
+}
+
+// MediaFile describes an uploaded file, items refer to it by its key
+type MediaFile struct {
+	BaseModel
+	Key         string `gorm:"uniqueIndex" json:"key"`
+	MediaType   string `json:"mediaType"`
+	ContentType string `json:"contentType"`
+	Size        int64  `json:"size"`
+	DurationMs  int64  `json:"durationMs"`
+	UserID      uint   `json:"userId"`
+}
+
+// ItemImage is one of the photos of an item, a question shows one of them
+type ItemImage struct {
+	BaseModel
+	ItemID   uint   `gorm:"index" json:"itemId"`
+	Image    string `json:"image"`
+	Caption  string `json:"caption"`
+	Position int    `json:"position"`
 }
 
 type User struct {
 	BaseModel
 	Username string `json:"username" gorm:"uniqueIndex"`
 	Password string
-	Exams []Exam
+	Exams    []Exam
+	// Guests play without an account until they sign up or log in
+	Guest bool
 }
 
-
 type ScorePoint struct {
 	BaseModel
-	ExamID uint
-	ItemID uint
-	UserID uint
-	Correct bool
+	ExamID    uint
+	ItemID    uint
+	UserID    uint `gorm:"uniqueIndex:idx_score_user_key"`
+	Correct   bool
+	SessionID *uint `gorm:"index"`
+	// Set for results synced from an offline pack, each one is stored only once
+	IdempotencyKey *string `gorm:"uniqueIndex:idx_score_user_key"`
+	// Offline pack the result was synced from, the client reports these answers so they stay off the leaderboards
+	PackID     *string `gorm:"index"`
+	ServedAt   *time.Time
+	AnsweredAt *time.Time
+	ResponseMs int64
+	TimedOut   bool
+	// Filter of the practice the answer was given in, nil when the whole exam was practiced
+	Filter *PracticeFilter `gorm:"serializer:json"`
+	// Kinds of the hints used on the question
+	Hints []string `gorm:"serializer:json"`
+	// Image shown in the question, nil when the item had no image list
+	ImageID *uint `gorm:"index"`
+	// Points the answer got under the scoring rules of the exam at the time
+	Points         int
+	ScoringVersion int
 }
 
+// PracticeFilter narrows down the items a practice picks questions and distractors from
+type PracticeFilter struct {
+	GroupIDs []uint `json:"groupIds,omitempty"`
+}
 
+// UsedTicket records a question ticket that was already answered
+type UsedTicket struct {
+	BaseModel
+	TicketID string `gorm:"uniqueIndex"`
+	UserID   uint
+}
+
+// UsedHint records a hint given for a question ticket, each kind is given once per ticket
+type UsedHint struct {
+	BaseModel
+	TicketID string `gorm:"uniqueIndex:idx_hint_ticket_kind"`
+	Kind     string `gorm:"uniqueIndex:idx_hint_ticket_kind"`
+	UserID   uint
+}
+
+// Confusion counts the wrong answers where the item was taken for the other one
+type Confusion struct {
+	BaseModel
+	ExamID         uint `gorm:"index"`
+	ItemID         uint `gorm:"uniqueIndex:idx_confusion_pair"`
+	ConfusedWithID uint `gorm:"uniqueIndex:idx_confusion_pair"`
+	Count          int
+}
+
+// GameSession is a round of questions fixed when the round starts
+type GameSession struct {
+	BaseModel
+	UserID  uint  `gorm:"uniqueIndex:idx_session_challenge_user" json:"userId"`
+	ExamID  uint  `json:"examId"`
+	GroupID *uint `json:"groupId"`
+	// Each user plays a daily challenge only once
+	ChallengeID *uint                 `gorm:"uniqueIndex:idx_session_challenge_user" json:"challengeId"`
+	FinishedAt  *time.Time            `json:"finishedAt"`
+	Questions   []GameSessionQuestion `gorm:"foreignKey:SessionID" json:"-"`
+}
+
+// DailyChallenge is the question sequence everyone plays on one day of an exam
+type DailyChallenge struct {
+	BaseModel
+	ExamID  uint   `gorm:"uniqueIndex:idx_challenge_exam_date" json:"examId"`
+	Date    string `gorm:"uniqueIndex:idx_challenge_exam_date" json:"date"`
+	Seed    int64  `json:"-"`
+	ItemIDs []uint `gorm:"serializer:json" json:"-"`
+}
+
+type GameSessionQuestion struct {
+	BaseModel
+	SessionID  uint `gorm:"index"`
+	ItemID     uint
+	Position   int
+	Answered   bool
+	Answer     string
+	Correct    bool
+	AnsweredAt *time.Time
+	Item       Item
+}
+
+// Attempt is one sitting of the formal assessment of an exam, kept apart from the practice score points
+type Attempt struct {
+	BaseModel
+	UserID     uint      `gorm:"index" json:"userId"`
+	ExamID     uint      `gorm:"index" json:"examId"`
+	DeadlineAt time.Time `json:"deadlineAt"`
+	// Set when the attempt gets locked, by submitting it or by running out of time
+	SubmittedAt *time.Time        `json:"submittedAt"`
+	TimedOut    bool              `json:"timedOut"`
+	Correct     int               `json:"correct"`
+	Total       int               `json:"total"`
+	Score       int               `json:"score"`
+	Questions   []AttemptQuestion `gorm:"foreignKey:AttemptID" json:"-"`
+}
+
+// AttemptQuestion is fixed when the attempt starts, later changes of the item don't affect it
+type AttemptQuestion struct {
+	BaseModel
+	AttemptID     uint `gorm:"uniqueIndex:idx_attempt_position"`
+	Position      int  `gorm:"uniqueIndex:idx_attempt_position"`
+	ItemID        uint
+	Image         string
+	Answers       []string `gorm:"serializer:json"`
+	CorrectAnswer string
+	Answer        string
+	AnsweredAt    *time.Time
+	Correct       bool
+}
+
+// ReviewState is the spaced-repetition schedule of one item for one user
+type ReviewState struct {
+	BaseModel
+	UserID      uint      `gorm:"uniqueIndex:idx_review_user_item" json:"userId"`
+	ItemID      uint      `gorm:"uniqueIndex:idx_review_user_item" json:"itemId"`
+	ExamID      uint      `gorm:"index" json:"examId"`
+	Repetitions int       `json:"repetitions"`
+	Interval    int       `json:"interval"`
+	EaseFactor  float64   `json:"easeFactor"`
+	DueAt       time.Time `json:"dueAt"`
+}
+
+// PlayerRating is the Elo skill of one user in one exam
+type PlayerRating struct {
+	BaseModel
+	UserID  uint    `gorm:"uniqueIndex:idx_rating_user_exam" json:"userId"`
+	ExamID  uint    `gorm:"uniqueIndex:idx_rating_user_exam" json:"examId"`
+	Rating  float64 `json:"rating"`
+	Answers int     `json:"answers"`
+}
 
 func (user *User) ToSimpleUser() SimpleUser {
 	return SimpleUser{
 		ID:       user.ID,
 		Username: user.Username,
+		Guest:    user.Guest,
 	}
 }
 
 type SimpleUser struct {
 	ID       uint   `json:"id"`
 	Username string `json:"username"`
+	Guest    bool   `json:"guest"`
 }
 
 func GetDB() *gorm.DB {
@@ -89,10 +338,62 @@ func GetDB() *gorm.DB {
 		panic("Failed to open database connection")
 	}
 
-	err = db.AutoMigrate(&Group{}, &Item{}, &User{}, &Exam{}, &ScorePoint{})
+	err = db.AutoMigrate(&Group{}, &Item{}, &ItemImage{}, &MediaFile{}, &User{}, &Exam{}, &ScorePoint{}, &ReviewState{}, &GameSession{}, &GameSessionQuestion{}, &UsedTicket{}, &UsedHint{}, &Confusion{}, &DailyChallenge{}, &PlayerRating{}, &Attempt{}, &AttemptQuestion{}, &ScoringPolicy{}, &ShareLink{}, &ExamShare{}, &ExamMember{})
 	if err != nil {
 		panic("Failed to auto migrate")
 	}
 
+	if err := migrateScoring(db); err != nil {
+		panic("Failed to migrate scoring rules")
+	}
+
 	return db
 }
+
+// migrateScoring gives the exams from before scoring rules the fixed rules they were scored by and freezes the points of their answers
+func migrateScoring(db *gorm.DB) error {
+	startedAt := time.Now()
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		var exams []Exam
+		if err := tx.Unscoped().Where("scoring_version = 0").Find(&exams).Error; err != nil {
+			return err
+		}
+
+		// Exams are migrated once, the answers given after that are scored by the rules of the exam
+		if len(exams) == 0 {
+			return nil
+		}
+
+		examIds := make([]uint, 0, len(exams))
+		for _, exam := range exams {
+			examIds = append(examIds, exam.ID)
+
+			rules := DefaultScoringRules
+			if exam.SpeedBonus {
+				rules.SpeedBonus = legacySpeedBonus
+			}
+
+			// The rules were in place since the exam was created
+			policy := ScoringPolicy{BaseModel: BaseModel{CreatedAt: exam.CreatedAt}, ExamID: exam.ID, Version: 1, Rules: rules}
+			if err := tx.Create(&policy).Error; err != nil {
+				return err
+			}
+
+			exam.Scoring = rules
+			exam.ScoringVersion = 1
+			if err := tx.Unscoped().Model(&exam).Select("scoring", "scoring_version").Updates(&exam).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Exec("UPDATE score_points SET scoring_version = 1, points = CASE WHEN NOT score_points.correct THEN -? ELSE ? "+
+			"+ CASE WHEN exams.speed_bonus AND score_points.response_ms > 0 THEN CAST(ROUND(GREATEST(0, 1 - score_points.response_ms::float / "+
+			"CASE WHEN exams.question_time_limit > 0 THEN exams.question_time_limit * 1000 ELSE 10000 END) * ?) AS INT) ELSE 0 END "+
+			"- COALESCE(json_array_length(score_points.hints::json), 0) * ? END "+
+			"FROM exams WHERE exams.id = score_points.exam_id AND score_points.scoring_version = 0 "+
+			"AND score_points.exam_id IN ? AND score_points.created_at < ?",
+			DefaultScoringRules.WrongPenalty, DefaultScoringRules.CorrectPoints, legacySpeedBonus, DefaultScoringRules.HintPenalty, examIds, startedAt,
+		).Error
+	})
+}
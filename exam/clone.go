@@ -0,0 +1,190 @@
+package exam
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"recognizer/db"
+	"recognizer/scoring"
+	"recognizer/types"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var errExamNameTaken = errors.New("Exam with this name already exists")
+
+// CloneExam copies an exam the user can see with its groups, items and images into a new private exam of the user.
+// The copies share the media keys of the source, uploads always get a new key and nothing deletes them, so neither exam can change the media of the other.
+func (service *Service) CloneExam(c *gin.Context) {
+	examIdParam, err := strconv.ParseUint(c.Param("examId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	source, err := service.findExam(c, uint(examIdParam))
+	if err != nil {
+		return
+	}
+
+	// The body is optional
+	var data types.CloneExamDto
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&data); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	clone := db.Exam{
+		Name:                data.Name,
+		UserID:              c.MustGet("userId").(uint),
+		MaxTypos:            source.MaxTypos,
+		StrictCase:          source.StrictCase,
+		StrictDiacritics:    source.StrictDiacritics,
+		QuestionTimeLimit:   source.QuestionTimeLimit,
+		AnswerCount:         source.AnswerCount,
+		QuestionTypes:       source.QuestionTypes,
+		AssessmentSize:      source.AssessmentSize,
+		AssessmentTimeLimit: source.AssessmentTimeLimit,
+		Visibility:          types.VisibilityPrivate,
+		SourceExamID:        &source.ID,
+	}
+
+	err = service.DB.Transaction(func(tx *gorm.DB) error {
+		if clone.Name == "" {
+			name, err := copyName(tx, source.Name)
+			if err != nil {
+				return err
+			}
+			clone.Name = name
+		}
+
+		var sameName int64
+		if err := tx.Model(&db.Exam{}).Where("name = ?", clone.Name).Count(&sameName).Error; err != nil {
+			return err
+		}
+		if sameName > 0 {
+			return errExamNameTaken
+		}
+
+		if err := tx.Create(&clone).Error; err != nil {
+			return err
+		}
+
+		// Creating takes zero typos for the column default
+		if err := tx.Model(&clone).Update("max_typos", source.MaxTypos).Error; err != nil {
+			return err
+		}
+
+		// Answers to the clone are scored the way the source scores them now
+		if err := scoring.SetRules(tx, &clone, source.Scoring); err != nil {
+			return err
+		}
+
+		return cloneContent(tx, source.ID, clone.ID)
+	})
+
+	if errors.Is(err, errExamNameTaken) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error cloning exam"})
+		return
+	}
+
+	service.DB.First(&clone)
+
+	c.JSON(200, clone)
+}
+
+// copyName is the first free name of a copy of the exam, "<name> (copy)" and then "<name> (copy 2)", "<name> (copy 3)" and so on
+func copyName(tx *gorm.DB, name string) (string, error) {
+	prefix := name + " (copy"
+
+	var names []string
+	if err := tx.Model(&db.Exam{}).Where("LEFT(name, ?) = ?", utf8.RuneCountInString(prefix), prefix).Pluck("name", &names).Error; err != nil {
+		return "", err
+	}
+
+	taken := make(map[string]bool, len(names))
+	for _, existing := range names {
+		taken[existing] = true
+	}
+
+	candidate := prefix + ")"
+	for copies := 2; taken[candidate]; copies++ {
+		candidate = fmt.Sprintf("%s %d)", prefix, copies)
+	}
+
+	return candidate, nil
+}
+
+// cloneContent copies the groups and the items with their images of one exam into another.
+// Ratings and answers stay behind, the items of the clone start over at the default rating.
+func cloneContent(tx *gorm.DB, sourceId uint, cloneId uint) error {
+	var groups []db.Group
+	if err := tx.Where("exam_id = ?", sourceId).Order("id").Find(&groups).Error; err != nil {
+		return err
+	}
+
+	groupIds := make(map[uint]uint, len(groups))
+	for _, group := range groups {
+		groupClone := db.Group{
+			Name:          group.Name,
+			ExamID:        cloneId,
+			SourceGroupID: &group.ID,
+		}
+		if err := tx.Create(&groupClone).Error; err != nil {
+			return err
+		}
+		groupIds[group.ID] = groupClone.ID
+	}
+
+	var items []db.Item
+	if err := tx.Preload("Images", orderedImages).Where("exam_id = ?", sourceId).Order("id").Find(&items).Error; err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		// Items of deleted groups aren't played anymore
+		groupId, ok := groupIds[item.GroupID]
+		if !ok {
+			continue
+		}
+
+		itemClone := db.Item{
+			Name:         item.Name,
+			Image:        item.Image,
+			Aliases:      item.Aliases,
+			GroupID:      groupId,
+			ExamID:       cloneId,
+			MediaType:    item.MediaType,
+			SourceItemID: &item.ID,
+		}
+		if err := tx.Create(&itemClone).Error; err != nil {
+			return err
+		}
+
+		for _, image := range item.Images {
+			imageClone := db.ItemImage{
+				ItemID:   itemClone.ID,
+				Image:    image.Image,
+				Caption:  image.Caption,
+				Position: image.Position,
+			}
+			if err := tx.Create(&imageClone).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func orderedImages(tx *gorm.DB) *gorm.DB {
+	return tx.Order("position")
+}
@@ -0,0 +1,123 @@
+package exam
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"recognizer/db"
+	"recognizer/types"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type DailyChallengeSummary struct {
+	ID        uint   `json:"id"`
+	Date      string `json:"date"`
+	Questions int    `json:"questions"`
+	Players   int    `json:"players"`
+}
+
+type DailyLeaderboardItem struct {
+	UserID      uint   `json:"userId"`
+	Username    string `json:"username"`
+	Correct     int    `json:"correct"`
+	Answered    int    `json:"answered"`
+	Finished    bool   `json:"finished"`
+	TimeTakenMs int64  `json:"timeTakenMs"`
+	Rank        int    `json:"rank"`
+}
+
+// ListDailyChallenges is the archive of the daily challenges of the exam, newest first
+func (service *Service) ListDailyChallenges(c *gin.Context) {
+	examIdParam, err := strconv.ParseUint(c.Param("examId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := service.findExam(c, uint(examIdParam)); err != nil {
+		return
+	}
+
+	var data []DailyChallengeSummary
+	err = service.DB.Model(&db.DailyChallenge{}).
+		Select("daily_challenges.id, daily_challenges.date, "+
+			"CAST(json_array_length(daily_challenges.item_ids::json) AS INT) as questions, "+
+			"CAST(COUNT(game_sessions.id) AS INT) as players",
+		).
+		Joins("LEFT JOIN game_sessions ON game_sessions.challenge_id = daily_challenges.id AND game_sessions.deleted_at IS NULL").
+		Where("daily_challenges.exam_id = ?", uint(examIdParam)).
+		Group("daily_challenges.id, daily_challenges.date, daily_challenges.item_ids").
+		Order("daily_challenges.date DESC").
+		Scan(&data).Error
+
+	if err != nil {
+		fmt.Println(err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error querying database"})
+		return
+	}
+
+	c.JSON(200, data)
+}
+
+// GetDailyLeaderboard ranks the players of one daily challenge, today's one unless a date is given.
+// More correct answers win, then finished runs, then the faster ones.
+func (service *Service) GetDailyLeaderboard(c *gin.Context) {
+	examIdParam, err := strconv.ParseUint(c.Param("examId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	date := c.DefaultQuery("date", time.Now().UTC().Format(types.DailyDateFormat))
+	if _, err := time.Parse(types.DailyDateFormat, date); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Date has to be in the YYYY-MM-DD format"})
+		return
+	}
+
+	if _, err := service.findExam(c, uint(examIdParam)); err != nil {
+		return
+	}
+
+	var challenge db.DailyChallenge
+	res := service.DB.Where("exam_id = ? AND date = ?", uint(examIdParam), date).First(&challenge)
+
+	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"message": "No daily challenge on this date"})
+		return
+	}
+
+	var data []DailyLeaderboardItem
+	err = service.DB.Model(&db.GameSession{}).
+		Select("game_sessions.user_id, users.username, "+
+			"CAST(SUM(CASE WHEN game_session_questions.correct THEN 1 ELSE 0 END) AS INT) as correct, "+
+			"CAST(SUM(CASE WHEN game_session_questions.answered THEN 1 ELSE 0 END) AS INT) as answered, "+
+			"game_sessions.finished_at IS NOT NULL as finished, "+
+			"CAST(EXTRACT(EPOCH FROM (COALESCE(game_sessions.finished_at, NOW()) - game_sessions.created_at)) * 1000 AS BIGINT) as time_taken_ms",
+		).
+		Joins("INNER JOIN users ON game_sessions.user_id = users.id").
+		Joins("INNER JOIN game_session_questions ON game_session_questions.session_id = game_sessions.id").
+		Where("game_sessions.challenge_id = ?", challenge.ID).
+		Group("game_sessions.id, users.username").
+		Order("correct DESC, finished DESC, time_taken_ms ASC, game_sessions.user_id ASC").
+		Scan(&data).Error
+
+	if err != nil {
+		fmt.Println(err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error querying database"})
+		return
+	}
+
+	// Same result, same rank
+	for i := range data {
+		data[i].Rank = i + 1
+		if i > 0 && data[i].Correct == data[i-1].Correct && data[i].Finished == data[i-1].Finished && data[i].TimeTakenMs == data[i-1].TimeTakenMs {
+			data[i].Rank = data[i-1].Rank
+		}
+	}
+
+	c.JSON(200, gin.H{"date": challenge.Date, "leaderboard": data})
+}
@@ -2,10 +2,11 @@ package exam
 
 import (
 	"errors"
-	"fmt"
-	"math"
 	"net/http"
+	"recognizer/access"
 	"recognizer/db"
+	"recognizer/game"
+	"recognizer/scoring"
 	"recognizer/types"
 	"strconv"
 
@@ -44,8 +45,18 @@ func (service *Service) CreateExam(c *gin.Context) {
 	createdExam := db.Exam{
 		Name: data.Name,
 		UserID: userId,
+		Visibility: types.VisibilityPrivate,
+	}
+	err := service.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&createdExam).Error; err != nil {
+			return err
+		}
+		return scoring.SetRules(tx, &createdExam, db.DefaultScoringRules)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error creating exam"})
+		return
 	}
-	service.DB.Create(&createdExam)
 
 	// Load fields from DB
 	service.DB.First(&createdExam)
@@ -71,13 +82,13 @@ func (service *Service) UpdateExam(c *gin.Context) {
 		return
 	}
 
-	if foundExam.UserID != userId {
+	if allowed, err := access.Can(service.DB, foundExam, userId, types.RoleOwner); err != nil || !allowed {
 		c.JSON(http.StatusUnauthorized, gin.H{"message": `Unathorized`})
 		return
 	}
 
 	// Get update request
-	var data types.CreateExamDto
+	var data types.UpdateExamDto
 
 	if err := c.ShouldBind(&data); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -85,83 +96,73 @@ func (service *Service) UpdateExam(c *gin.Context) {
 	}
 
 	foundExam.Name = data.Name
-	service.DB.Save(&foundExam)
-
-	// Load fields from DB
-	service.DB.First(&foundExam)
-
-	c.JSON(200, foundExam)
-}
+	if data.MaxTypos != nil {
+		foundExam.MaxTypos = *data.MaxTypos
+	}
+	if data.StrictCase != nil {
+		foundExam.StrictCase = *data.StrictCase
+	}
+	if data.StrictDiacritics != nil {
+		foundExam.StrictDiacritics = *data.StrictDiacritics
+	}
+	if data.QuestionTimeLimit != nil {
+		foundExam.QuestionTimeLimit = *data.QuestionTimeLimit
+	}
+	if data.AnswerCount != nil {
+		foundExam.AnswerCount = *data.AnswerCount
+	}
+	if data.QuestionTypes != nil {
+		for questionType := range data.QuestionTypes {
+			if _, ok := game.Generator(questionType); !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"message": "Unknown question type " + questionType})
+				return
+			}
+		}
+		foundExam.QuestionTypes = data.QuestionTypes
+	}
+	if data.AssessmentSize != nil {
+		foundExam.AssessmentSize = *data.AssessmentSize
+	}
+	if data.AssessmentTimeLimit != nil {
+		foundExam.AssessmentTimeLimit = *data.AssessmentTimeLimit
+	}
+	if data.Visibility != nil {
+		foundExam.Visibility = *data.Visibility
+	}
 
-func (service *Service) GetExam(c *gin.Context) {
-	examIdParam, err := strconv.ParseUint(c.Param("examId"), 10, 32)
+	err = service.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&foundExam).Error; err != nil {
+			return err
+		}
+		if data.Scoring == nil {
+			return nil
+		}
+		return scoring.SetRules(tx, foundExam, db.ScoringRules(*data.Scoring))
+	})
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating exam"})
 		return
 	}
 
-	var foundExam *db.Exam
-	res := service.DB.First(&foundExam, uint(examIdParam))
-
-	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
-		c.JSON(http.StatusNotFound, gin.H{"message": "Exam not found"})
-		return
-	}
+	// Load fields from DB
+	service.DB.First(&foundExam)
 
 	c.JSON(200, foundExam)
 }
 
-type LeaderboardItem struct {
-	UserID    uint   `json:"userId"`
-	Correct   int    `json:"correct"`
-	Wrong     int    `json:"wrong"`
-	Nickname  string `json:"nickname"`
-	Total     int    `json:"total"`
-	Points    int    `json:"points"`
-	Percentage int    `json:"percentage"`
-}
-
-func(service  *Service) GetExamStats(c *gin.Context){
+func (service *Service) GetExam(c *gin.Context) {
 	examIdParam, err := strconv.ParseUint(c.Param("examId"), 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	var data []LeaderboardItem
-	err = service.DB.Model(&db.ScorePoint{}).
-		Select("score_points.user_id, "+
-			"CAST(SUM(CASE WHEN score_points.correct THEN 1 ELSE 0 END) AS INT) as correct, "+
-			"CAST(SUM(CASE WHEN score_points.correct THEN 0 ELSE 1 END) AS INT) as wrong, "+
-			"users.username",
-		).
-		Where("score_points.exam_id = ?", uint(examIdParam)).
-		Joins("INNER JOIN users ON score_points.user_id = users.id").
-		Group("score_points.user_id, users.username").
-		Scan(&data).Error
-
+	foundExam, err := service.findExam(c, uint(examIdParam))
 	if err != nil {
-		fmt.Println(err.Error())
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error querying database"})
 		return
 	}
 
-	for i, item := range data {
-		total := item.Correct + item.Wrong
-		data[i].Total = total
-		data[i].Points = (item.Correct * 10) - (item.Wrong * 5) + 100
-		data[i].Percentage = int(math.Round((float64(item.Correct) / float64(total)) * 100))
-	}
-
-	// Sort by points in descending order (using a simple bubble sort for this example)
-	for i := 0; i < len(data)-1; i++ {
-		for j := i + 1; j < len(data); j++ {
-			if data[i].Points < data[j].Points {
-				data[i], data[j] = data[j], data[i]
-			}
-		}
-	}
-
+	c.JSON(200, foundExam)
 }
 
 func (service *Service) DeleteExam(c *gin.Context) {
@@ -181,7 +182,7 @@ func (service *Service) DeleteExam(c *gin.Context) {
 		return
 	}
 
-	if foundExam.UserID != userId {
+	if allowed, err := access.Can(service.DB, foundExam, userId, types.RoleOwner); err != nil || !allowed {
 		c.JSON(http.StatusUnauthorized, gin.H{"message": "Unauthorized"})
 		return
 	}
@@ -191,10 +192,29 @@ func (service *Service) DeleteExam(c *gin.Context) {
 	c.JSON(200, gin.H{"message": "Successfully deleted exam"})
 }
 
+// ListExams lists the exams of the user, or the public catalog of everyone's exams
 func (service *Service) ListExams(c *gin.Context) {
+	userId := c.MustGet("userId").(uint)
+
 	var exams []db.Exam
+	var err error
+
+	switch c.DefaultQuery("view", "mine") {
+	case "mine":
+		// Exams the user created or accepted an invitation to
+		memberOf := service.DB.Model(&db.ExamMember{}).Select("exam_id").Where("user_id = ? AND accepted_at IS NOT NULL", userId)
+		err = service.DB.Where("user_id = ? OR id IN (?)", userId, memberOf).Order("name").Find(&exams).Error
+	case "catalog":
+		err = service.DB.Where("visibility = ?", types.VisibilityPublic).Order("name").Find(&exams).Error
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Unknown view"})
+		return
+	}
 
-	service.DB.Find(&exams)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error loading exams"})
+		return
+	}
 
 	c.JSON(200, exams)
 }
@@ -0,0 +1,244 @@
+package exam
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"recognizer/db"
+	"recognizer/scoring"
+	"recognizer/types"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultLeaderboardLimit = 20
+	// Players shown above and below the caller
+	leaderboardNeighbours = 2
+)
+
+type LeaderboardItem struct {
+	UserID     uint   `json:"userId"`
+	Correct    int    `json:"correct"`
+	Wrong      int    `json:"wrong"`
+	Nickname   string `json:"nickname"`
+	Total      int    `json:"total"`
+	Points     int    `json:"points"`
+	Hints      int    `json:"hints"`
+	Percentage int    `json:"percentage"`
+	// Players with the same points share a rank
+	Rank     int `json:"rank"`
+	Position int `json:"-"`
+}
+
+type Leaderboard struct {
+	Window string `json:"window"`
+	// Bounds of the window, empty for all time
+	Since   *time.Time        `json:"since"`
+	Until   *time.Time        `json:"until"`
+	Players int64             `json:"players"`
+	Items   []LeaderboardItem `json:"items"`
+	// Empty on the last page
+	NextCursor string `json:"nextCursor,omitempty"`
+	// The caller and the players around them, empty when the caller didn't play in the window
+	Me     *LeaderboardItem  `json:"me"`
+	Around []LeaderboardItem `json:"around"`
+}
+
+var errInvalidCursor = errors.New("Invalid cursor")
+
+// windowBounds are the start and the end of the calendar period of the window the day falls in, nil for all time
+func windowBounds(window string, day time.Time) (*time.Time, *time.Time) {
+	day = day.UTC()
+	start := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+
+	var end time.Time
+	switch window {
+	case types.LeaderboardDay:
+		end = start.AddDate(0, 0, 1)
+	case types.LeaderboardWeek:
+		// Weeks start on monday
+		start = start.AddDate(0, 0, -((int(start.Weekday()) + 6) % 7))
+		end = start.AddDate(0, 0, 7)
+	case types.LeaderboardMonth:
+		start = time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, time.UTC)
+		end = start.AddDate(0, 1, 0)
+	default:
+		return nil, nil
+	}
+
+	return &start, &end
+}
+
+// The cursor is the position of the last player of a page in the leaderboard order
+func encodeCursor(item LeaderboardItem) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%d", item.Points, item.UserID)))
+}
+
+func decodeCursor(cursor string) (int, uint, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, 0, errInvalidCursor
+	}
+
+	pointsPart, userPart, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return 0, 0, errInvalidCursor
+	}
+
+	points, err := strconv.Atoi(pointsPart)
+	if err != nil {
+		return 0, 0, errInvalidCursor
+	}
+	userId, err := strconv.ParseUint(userPart, 10, 32)
+	if err != nil {
+		return 0, 0, errInvalidCursor
+	}
+
+	return points, uint(userId), nil
+}
+
+// rankedScores sums up the points the answers of every player in the window got and ranks the players, answers synced from offline packs don't count.
+// Players are ordered by points and then by user id, so players sharing a rank always come in the same order.
+func (service *Service) rankedScores(exam *db.Exam, since *time.Time, until *time.Time, rules db.ScoringRules) *gorm.DB {
+	points := "? + CAST(SUM(score_points.points) AS INT)"
+	if rules.FloorAtZero {
+		points = "GREATEST(0, " + points + ")"
+	}
+
+	totals := service.DB.Model(&db.ScorePoint{}).
+		Select("score_points.user_id, users.username as nickname, "+
+			"CAST(SUM(CASE WHEN score_points.correct THEN 1 ELSE 0 END) AS INT) as correct, "+
+			"CAST(SUM(CASE WHEN score_points.correct THEN 0 ELSE 1 END) AS INT) as wrong, "+
+			"CAST(COUNT(score_points.id) AS INT) as total, "+
+			"CAST(SUM(CASE WHEN score_points.correct THEN COALESCE(json_array_length(score_points.hints::json), 0) ELSE 0 END) AS INT) as hints, "+
+			points+" as points, "+
+			"CAST(ROUND(SUM(CASE WHEN score_points.correct THEN 1 ELSE 0 END) * 100.0 / COUNT(score_points.id)) AS INT) as percentage",
+			rules.BaseScore,
+		).
+		Joins("INNER JOIN users ON score_points.user_id = users.id").
+		Where("score_points.exam_id = ? AND score_points.pack_id IS NULL", exam.ID).
+		Group("score_points.user_id, users.username")
+
+	if since != nil {
+		totals = totals.Where("score_points.created_at >= ? AND score_points.created_at < ?", *since, *until)
+	}
+
+	return service.DB.Table("(?) as totals", totals).
+		Select("totals.*, " +
+			"CAST(RANK() OVER (ORDER BY totals.points DESC) AS INT) as rank, " +
+			"CAST(ROW_NUMBER() OVER (ORDER BY totals.points DESC, totals.user_id ASC) AS INT) as position",
+		)
+}
+
+// GetExamStats is the leaderboard of the exam over all time or a calendar period, a page of it along with the caller and their neighbours
+func (service *Service) GetExamStats(c *gin.Context) {
+	examIdParam, err := strconv.ParseUint(c.Param("examId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var query types.LeaderboardQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if query.Cursor != "" && query.Offset > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Use either an offset or a cursor"})
+		return
+	}
+	if query.Window == "" {
+		query.Window = types.LeaderboardAllTime
+	}
+	if query.Limit == 0 {
+		query.Limit = defaultLeaderboardLimit
+	}
+
+	userId := c.MustGet("userId").(uint)
+
+	foundExam, err := service.findExam(c, uint(examIdParam))
+	if err != nil {
+		return
+	}
+
+	day := time.Now()
+	if query.Date != "" {
+		day, err = time.Parse(types.DailyDateFormat, query.Date)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Date has to be in the YYYY-MM-DD format"})
+			return
+		}
+	}
+
+	since, until := windowBounds(query.Window, day)
+	leaderboard := Leaderboard{Window: query.Window, Since: since, Until: until, Items: []LeaderboardItem{}, Around: []LeaderboardItem{}}
+
+	// Past windows keep the base score and the floor they ended with
+	rules := foundExam.Scoring
+	if until != nil {
+		rules, err = scoring.RulesAt(service.DB, foundExam, *until)
+		if err != nil {
+			fmt.Println(err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error querying database"})
+			return
+		}
+	}
+
+	page := service.DB.Table("(?) as ranked", service.rankedScores(foundExam, since, until, rules))
+	if query.Cursor != "" {
+		points, cursorUserId, err := decodeCursor(query.Cursor)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			return
+		}
+		page = page.Where("ranked.points < ? OR (ranked.points = ? AND ranked.user_id > ?)", points, points, cursorUserId)
+	}
+
+	// One more than asked for tells whether there is a next page
+	err = page.Order("ranked.position").Offset(query.Offset).Limit(query.Limit + 1).Scan(&leaderboard.Items).Error
+	if err != nil {
+		fmt.Println(err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error querying database"})
+		return
+	}
+
+	if len(leaderboard.Items) > query.Limit {
+		leaderboard.Items = leaderboard.Items[:query.Limit]
+		leaderboard.NextCursor = encodeCursor(leaderboard.Items[query.Limit-1])
+	}
+
+	err = service.DB.Table("(?) as ranked", service.rankedScores(foundExam, since, until, rules)).Count(&leaderboard.Players).Error
+	if err != nil {
+		fmt.Println(err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error querying database"})
+		return
+	}
+
+	ranked := service.rankedScores(foundExam, since, until, rules)
+	myPosition := service.DB.Table("(?) as mine", ranked).Select("mine.position").Where("mine.user_id = ?", userId)
+	err = service.DB.Table("(?) as ranked", ranked).
+		Where("ranked.position BETWEEN (?) - ? AND (?) + ?", myPosition, leaderboardNeighbours, myPosition, leaderboardNeighbours).
+		Order("ranked.position").
+		Scan(&leaderboard.Around).Error
+
+	if err != nil {
+		fmt.Println(err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error querying database"})
+		return
+	}
+
+	for i, item := range leaderboard.Around {
+		if item.UserID == userId {
+			leaderboard.Me = &leaderboard.Around[i]
+		}
+	}
+
+	c.JSON(200, leaderboard)
+}
@@ -0,0 +1,265 @@
+package exam
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"recognizer/access"
+	"recognizer/db"
+	"recognizer/types"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ListMembers lists the members of the exam and the pending invitations to it, any member can see them
+func (service *Service) ListMembers(c *gin.Context) {
+	examIdParam, err := strconv.ParseUint(c.Param("examId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	foundExam, err := service.findExam(c, uint(examIdParam))
+	if err != nil {
+		return
+	}
+
+	if allowed, err := access.Can(service.DB, foundExam, c.MustGet("userId").(uint), types.RoleViewer); err != nil || !allowed {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Unauthorized"})
+		return
+	}
+
+	var members []types.ExamMemberItem
+	err = service.DB.Model(&db.ExamMember{}).
+		Select("exam_members.id, exam_members.user_id, users.username, exam_members.role, "+
+			"exam_members.accepted_at IS NOT NULL as accepted").
+		Joins("INNER JOIN users ON users.id = exam_members.user_id").
+		Where("exam_members.exam_id = ?", foundExam.ID).
+		Order("exam_members.id").
+		Scan(&members).Error
+
+	if err != nil {
+		fmt.Println(err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error querying database"})
+		return
+	}
+
+	c.JSON(200, members)
+}
+
+// InviteMember invites a user by their username, the role applies once they accept
+func (service *Service) InviteMember(c *gin.Context) {
+	foundExam, err := service.ownedExam(c)
+	if err != nil {
+		return
+	}
+
+	var data types.InviteMemberDto
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Guests can't be invited, they may be gone tomorrow
+	var invited db.User
+	res := service.DB.Where("username = ? AND guest = ?", data.Username, false).First(&invited)
+
+	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"message": "User not found"})
+		return
+	}
+
+	if invited.ID == foundExam.UserID {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "User already owns this exam"})
+		return
+	}
+
+	var existing int64
+	service.DB.Model(&db.ExamMember{}).Where("exam_id = ? AND user_id = ?", foundExam.ID, invited.ID).Count(&existing)
+
+	if existing > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "User is already a member or invited"})
+		return
+	}
+
+	member := db.ExamMember{
+		ExamID:    foundExam.ID,
+		UserID:    invited.ID,
+		Role:      data.Role,
+		InvitedBy: c.MustGet("userId").(uint),
+	}
+
+	if err := service.DB.Create(&member).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error inviting user"})
+		return
+	}
+
+	c.JSON(200, member)
+}
+
+// UpdateMember changes the role of a member or of a pending invitation
+func (service *Service) UpdateMember(c *gin.Context) {
+	foundExam, err := service.ownedExam(c)
+	if err != nil {
+		return
+	}
+
+	member, err := service.findMember(c, foundExam)
+	if err != nil {
+		return
+	}
+
+	var data types.UpdateMemberDto
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	member.Role = data.Role
+	if err := service.DB.Model(member).Update("role", member.Role).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating member"})
+		return
+	}
+
+	c.JSON(200, member)
+}
+
+// RemoveMember takes a member out of the exam or withdraws an invitation, members can also leave by themselves
+func (service *Service) RemoveMember(c *gin.Context) {
+	examIdParam, err := strconv.ParseUint(c.Param("examId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userId := c.MustGet("userId").(uint)
+
+	var foundExam *db.Exam
+	res := service.DB.First(&foundExam, uint(examIdParam))
+
+	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Exam not found"})
+		return
+	}
+
+	member, err := service.findMember(c, foundExam)
+	if err != nil {
+		return
+	}
+
+	if member.UserID != userId {
+		if allowed, err := access.Can(service.DB, foundExam, userId, types.RoleOwner); err != nil || !allowed {
+			c.JSON(http.StatusUnauthorized, gin.H{"message": "Unauthorized"})
+			return
+		}
+	}
+
+	// Removed members can be invited again
+	if err := service.DB.Unscoped().Delete(member).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error removing member"})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "Member removed"})
+}
+
+// findMember loads the member from the URL and writes the error response when it can't
+func (service *Service) findMember(c *gin.Context, exam *db.Exam) (*db.ExamMember, error) {
+	memberIdParam, err := strconv.ParseUint(c.Param("memberId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, err
+	}
+
+	var member *db.ExamMember
+	res := service.DB.Where("exam_id = ?", exam.ID).First(&member, uint(memberIdParam))
+
+	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Member not found"})
+		return nil, res.Error
+	}
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error loading member"})
+		return nil, res.Error
+	}
+
+	return member, nil
+}
+
+// ListInvitations lists the invitations the user hasn't answered yet
+func (service *Service) ListInvitations(c *gin.Context) {
+	var invitations []types.ExamInvitation
+	err := service.DB.Model(&db.ExamMember{}).
+		Select("exam_members.id, exam_members.exam_id, exams.name as exam_name, exam_members.role, users.username as invited_by").
+		Joins("INNER JOIN exams ON exams.id = exam_members.exam_id AND exams.deleted_at IS NULL").
+		Joins("INNER JOIN users ON users.id = exam_members.invited_by").
+		Where("exam_members.user_id = ? AND exam_members.accepted_at IS NULL", c.MustGet("userId").(uint)).
+		Order("exam_members.id DESC").
+		Scan(&invitations).Error
+
+	if err != nil {
+		fmt.Println(err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error querying database"})
+		return
+	}
+
+	c.JSON(200, invitations)
+}
+
+// AcceptInvitation makes the user a member of the exam they were invited to
+func (service *Service) AcceptInvitation(c *gin.Context) {
+	invitation, err := service.findInvitation(c)
+	if err != nil {
+		return
+	}
+
+	now := time.Now()
+	invitation.AcceptedAt = &now
+	if err := service.DB.Model(invitation).Update("accepted_at", now).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error accepting invitation"})
+		return
+	}
+
+	c.JSON(200, invitation)
+}
+
+// DeclineInvitation turns the invitation down, the user can be invited again
+func (service *Service) DeclineInvitation(c *gin.Context) {
+	invitation, err := service.findInvitation(c)
+	if err != nil {
+		return
+	}
+
+	if err := service.DB.Unscoped().Delete(invitation).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error declining invitation"})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "Invitation declined"})
+}
+
+// findInvitation loads a pending invitation addressed to the user and writes the error response when it can't
+func (service *Service) findInvitation(c *gin.Context) (*db.ExamMember, error) {
+	memberIdParam, err := strconv.ParseUint(c.Param("memberId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, err
+	}
+
+	var invitation *db.ExamMember
+	res := service.DB.Where("user_id = ? AND accepted_at IS NULL", c.MustGet("userId").(uint)).First(&invitation, uint(memberIdParam))
+
+	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Invitation not found"})
+		return nil, res.Error
+	}
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error loading invitation"})
+		return nil, res.Error
+	}
+
+	return invitation, nil
+}
@@ -0,0 +1,74 @@
+package exam
+
+import (
+	"fmt"
+	"net/http"
+	"recognizer/db"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ItemRating struct {
+	ItemID  uint    `json:"itemId"`
+	Name    string  `json:"name"`
+	Image   string  `json:"image"`
+	GroupID uint    `json:"groupId"`
+	Rating  float64 `json:"rating"`
+	Answers int     `json:"answers"`
+	Correct int     `json:"correct"`
+}
+
+type PlayerRatingItem struct {
+	UserID   uint    `json:"userId"`
+	Username string  `json:"username"`
+	Rating   float64 `json:"rating"`
+	Answers  int     `json:"answers"`
+}
+
+// GetExamRatings lists the Elo ratings of the exam, the hardest items and the strongest players first
+func (service *Service) GetExamRatings(c *gin.Context) {
+	examIdParam, err := strconv.ParseUint(c.Param("examId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := service.findExam(c, uint(examIdParam)); err != nil {
+		return
+	}
+
+	var items []ItemRating
+	err = service.DB.Model(&db.Item{}).
+		Select("items.id as item_id, items.name, items.image, items.group_id, items.rating, "+
+			"CAST(COUNT(score_points.id) AS INT) as answers, "+
+			"CAST(SUM(CASE WHEN score_points.correct THEN 1 ELSE 0 END) AS INT) as correct",
+		).
+		Joins("LEFT JOIN score_points ON score_points.item_id = items.id AND score_points.deleted_at IS NULL").
+		Where("items.exam_id = ?", uint(examIdParam)).
+		Group("items.id").
+		Order("items.rating DESC, items.id").
+		Scan(&items).Error
+
+	if err != nil {
+		fmt.Println(err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error querying database"})
+		return
+	}
+
+	var players []PlayerRatingItem
+	err = service.DB.Model(&db.PlayerRating{}).
+		Select("player_ratings.user_id, users.username, player_ratings.rating, player_ratings.answers").
+		Joins("INNER JOIN users ON player_ratings.user_id = users.id").
+		Where("player_ratings.exam_id = ?", uint(examIdParam)).
+		Order("player_ratings.rating DESC, player_ratings.user_id").
+		Scan(&players).Error
+
+	if err != nil {
+		fmt.Println(err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error querying database"})
+		return
+	}
+
+	c.JSON(200, gin.H{"items": items, "players": players})
+}
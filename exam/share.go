@@ -0,0 +1,161 @@
+package exam
+
+import (
+	"errors"
+	"net/http"
+	"recognizer/access"
+	"recognizer/db"
+	"recognizer/types"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// findExam loads the exam if the user can see it and writes the error response when they can't
+func (service *Service) findExam(c *gin.Context, examId uint) (*db.Exam, error) {
+	foundExam, err := access.FindExam(service.DB, examId, c.MustGet("userId").(uint))
+	if errors.Is(err, access.ErrExamNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Exam not found"})
+		return nil, err
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error loading exam"})
+		return nil, err
+	}
+
+	return foundExam, nil
+}
+
+// ownedExam loads the exam from the URL if the user is one of its owners and writes the error response when they aren't
+func (service *Service) ownedExam(c *gin.Context) (*db.Exam, error) {
+	examIdParam, err := strconv.ParseUint(c.Param("examId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, err
+	}
+
+	var foundExam *db.Exam
+	res := service.DB.First(&foundExam, uint(examIdParam))
+
+	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Exam not found"})
+		return nil, res.Error
+	}
+
+	if allowed, err := access.Can(service.DB, foundExam, c.MustGet("userId").(uint), types.RoleOwner); err != nil || !allowed {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Unauthorized"})
+		return nil, errors.New("Unauthorized")
+	}
+
+	return foundExam, nil
+}
+
+// CreateShareLink adds a link the owner can hand out to let others see the exam while it is unlisted
+func (service *Service) CreateShareLink(c *gin.Context) {
+	foundExam, err := service.ownedExam(c)
+	if err != nil {
+		return
+	}
+
+	link := db.ShareLink{
+		ExamID: foundExam.ID,
+		Token:  strings.ReplaceAll(uuid.New().String(), "-", ""),
+		UserID: foundExam.UserID,
+	}
+
+	if err := service.DB.Create(&link).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error creating share link"})
+		return
+	}
+
+	c.JSON(200, link)
+}
+
+// ListShareLinks lists the share links of the exam with the revoked ones, newest first
+func (service *Service) ListShareLinks(c *gin.Context) {
+	foundExam, err := service.ownedExam(c)
+	if err != nil {
+		return
+	}
+
+	var links []db.ShareLink
+	if err := service.DB.Where("exam_id = ?", foundExam.ID).Order("id DESC").Find(&links).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error loading share links"})
+		return
+	}
+
+	c.JSON(200, links)
+}
+
+// RevokeShareLink stops the link from working, the users who opened it lose access unless they have another link
+func (service *Service) RevokeShareLink(c *gin.Context) {
+	foundExam, err := service.ownedExam(c)
+	if err != nil {
+		return
+	}
+
+	linkIdParam, err := strconv.ParseUint(c.Param("linkId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var link db.ShareLink
+	res := service.DB.Where("exam_id = ?", foundExam.ID).First(&link, uint(linkIdParam))
+
+	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Share link not found"})
+		return
+	}
+
+	if link.RevokedAt == nil {
+		now := time.Now()
+		link.RevokedAt = &now
+		if err := service.DB.Model(&link).Update("revoked_at", now).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error revoking share link"})
+			return
+		}
+	}
+
+	c.JSON(200, link)
+}
+
+// OpenShareLink gives the user access to the exam of the link, guests included
+func (service *Service) OpenShareLink(c *gin.Context) {
+	userId := c.MustGet("userId").(uint)
+
+	var link db.ShareLink
+	res := service.DB.Where("token = ? AND revoked_at IS NULL", c.Param("token")).First(&link)
+
+	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Share link not found"})
+		return
+	}
+
+	// Private exams can't be shared, the link works again once the exam is unlisted
+	var foundExam *db.Exam
+	res = service.DB.First(&foundExam, link.ExamID)
+
+	if errors.Is(res.Error, gorm.ErrRecordNotFound) || foundExam.Visibility == types.VisibilityPrivate {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Exam not found"})
+		return
+	}
+
+	share := db.ExamShare{UserID: userId, ShareLinkID: link.ID, ExamID: link.ExamID}
+	err := service.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "share_link_id"}},
+		DoNothing: true,
+	}).Create(&share).Error
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error opening share link"})
+		return
+	}
+
+	c.JSON(200, foundExam)
+}
@@ -2,9 +2,12 @@ package files
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"recognizer/db"
 	"recognizer/types"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -39,7 +42,11 @@ func NewFilesService(config types.ServiceConfig) Service {
 }
 
 func (service *Service) UploadFile(c *gin.Context) {
-	file, _ := c.FormFile("file")
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	f, err := file.Open()
 	if err != nil {
@@ -48,17 +55,76 @@ func (service *Service) UploadFile(c *gin.Context) {
 	}
 	defer f.Close()
 
-	key := uuid.New().String()
+	// The content type sent by the client isn't trusted, the format is sniffed from the file
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	format, err := detectFormat(head[:n])
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if file.Size > maxMediaSize[format.MediaType] {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("Files of this type can have at most %d MB", maxMediaSize[format.MediaType]>>20)})
+		return
+	}
+
+	var durationMs int64
+	if maxDuration, ok := maxMediaDuration[format.MediaType]; ok {
+		// The duration the client sends isn't trusted either, files it can't be read from are refused
+		duration, ok := mediaDuration(format, f, file.Size)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Duration of the file can't be read"})
+			return
+		}
+
+		if duration > maxDuration {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Files of this type can be at most %d seconds long", int(maxDuration.Seconds()))})
+			return
+		}
+		durationMs = duration.Milliseconds()
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	key := mediaKeyPrefixes[format.MediaType] + uuid.New().String() + format.Extension
 
 	_, err = service.S3.PutObject(c.Request.Context(), &s3.PutObjectInput{
-		Bucket: aws.String("recognizer"),
-		Key:    aws.String(key),
-		Body:   f,
+		Bucket:      aws.String("recognizer"),
+		Key:         aws.String(key),
+		Body:        f,
+		ContentType: aws.String(format.ContentType),
 	})
 
 	if err != nil {
 		fmt.Println(err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error uploading file"})
+		return
 	}
 
-	c.JSON(200, gin.H{"url": key})
+	mediaFile := db.MediaFile{
+		Key:         key,
+		MediaType:   format.MediaType,
+		ContentType: format.ContentType,
+		Size:        file.Size,
+		DurationMs:  durationMs,
+		UserID:      c.MustGet("userId").(uint),
+	}
+	service.DB.Create(&mediaFile)
+
+	c.JSON(200, types.UploadedFile{
+		Url:         key,
+		MediaType:   format.MediaType,
+		ContentType: format.ContentType,
+		Size:        file.Size,
+		DurationMs:  durationMs,
+	})
 }
@@ -0,0 +1,488 @@
+package files
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"math/bits"
+	"net/http"
+	"recognizer/types"
+	"time"
+)
+
+// mediaFormat is a file format accepted for upload
+type mediaFormat struct {
+	MediaType   string
+	ContentType string
+	Extension   string
+}
+
+// Keyed by the content type net/http sniffs
+var mediaFormats = map[string]mediaFormat{
+	"image/jpeg":      {types.MediaImage, "image/jpeg", ".jpg"},
+	"image/png":       {types.MediaImage, "image/png", ".png"},
+	"image/gif":       {types.MediaImage, "image/gif", ".gif"},
+	"image/webp":      {types.MediaImage, "image/webp", ".webp"},
+	"audio/mpeg":      {types.MediaAudio, "audio/mpeg", ".mp3"},
+	"audio/wave":      {types.MediaAudio, "audio/wav", ".wav"},
+	"application/ogg": {types.MediaAudio, "audio/ogg", ".ogg"},
+	"video/mp4":       {types.MediaVideo, "video/mp4", ".mp4"},
+	"video/webm":      {types.MediaVideo, "video/webm", ".webm"},
+}
+
+var m4aFormat = mediaFormat{types.MediaAudio, "audio/mp4", ".m4a"}
+
+// Keys of uploaded files start with the kind of their media, older keys have no prefix
+var mediaKeyPrefixes = map[string]string{
+	types.MediaImage: "images/",
+	types.MediaAudio: "audio/",
+	types.MediaVideo: "video/",
+}
+
+var maxMediaSize = map[string]int64{
+	types.MediaImage: 10 << 20,
+	types.MediaAudio: 20 << 20,
+	types.MediaVideo: 50 << 20,
+}
+
+var maxMediaDuration = map[string]time.Duration{
+	types.MediaAudio: time.Minute,
+	types.MediaVideo: 30 * time.Second,
+}
+
+var errUnknownFormat = errors.New("Unsupported file format")
+
+// detectFormat tells the format of a file by its first bytes
+func detectFormat(head []byte) (mediaFormat, error) {
+	contentType := http.DetectContentType(head)
+
+	// MP3 files without an ID3 tag start right with a frame header
+	if contentType == "application/octet-stream" && len(head) > 1 && head[0] == 0xFF && head[1]&0xE0 == 0xE0 {
+		contentType = "audio/mpeg"
+	}
+
+	format, ok := mediaFormats[contentType]
+	if !ok {
+		return mediaFormat{}, errUnknownFormat
+	}
+
+	// Audio in an MP4 container has its own brand
+	if format.ContentType == "video/mp4" && len(head) >= 12 && string(head[8:12]) == "M4A " {
+		return m4aFormat, nil
+	}
+
+	return format, nil
+}
+
+// mediaDuration reads the duration from the file itself, false when it can't be read
+func mediaDuration(format mediaFormat, file io.ReaderAt, size int64) (time.Duration, bool) {
+	switch format.ContentType {
+	case "audio/wav":
+		return wavDuration(file, size)
+	case "video/mp4", "audio/mp4":
+		return mp4Duration(file, 0, size)
+	case "audio/mpeg":
+		return mp3Duration(file, size)
+	case "audio/ogg":
+		return oggDuration(file, size)
+	case "video/webm":
+		return webmDuration(file, size)
+	}
+
+	return 0, false
+}
+
+// wavDuration divides the size of the data chunk by the byte rate of the fmt chunk
+func wavDuration(file io.ReaderAt, size int64) (time.Duration, bool) {
+	var byteRate, dataSize uint32
+	header := make([]byte, 8)
+
+	for offset := int64(12); offset+8 <= size; {
+		if _, err := file.ReadAt(header, offset); err != nil {
+			return 0, false
+		}
+		chunkSize := binary.LittleEndian.Uint32(header[4:])
+
+		switch string(header[:4]) {
+		case "fmt ":
+			format := make([]byte, 12)
+			if _, err := file.ReadAt(format, offset+8); err != nil {
+				return 0, false
+			}
+			byteRate = binary.LittleEndian.Uint32(format[8:])
+		case "data":
+			dataSize = chunkSize
+		}
+
+		if byteRate > 0 && dataSize > 0 {
+			return time.Duration(float64(dataSize) / float64(byteRate) * float64(time.Second)), true
+		}
+
+		// Chunks are padded to an even size
+		offset += 8 + int64(chunkSize) + int64(chunkSize%2)
+	}
+
+	return 0, false
+}
+
+// mp4Duration looks for the movie header box inside the movie box and reads its duration
+func mp4Duration(file io.ReaderAt, start int64, end int64) (time.Duration, bool) {
+	header := make([]byte, 8)
+
+	for offset := start; offset+8 <= end; {
+		if _, err := file.ReadAt(header, offset); err != nil {
+			return 0, false
+		}
+		boxSize := int64(binary.BigEndian.Uint32(header[:4]))
+		headerSize := int64(8)
+
+		switch boxSize {
+		case 0:
+			// The box runs to the end of the file
+			boxSize = end - offset
+		case 1:
+			large := make([]byte, 8)
+			if _, err := file.ReadAt(large, offset+8); err != nil {
+				return 0, false
+			}
+			boxSize = int64(binary.BigEndian.Uint64(large))
+			headerSize = 16
+		}
+
+		if boxSize < headerSize {
+			return 0, false
+		}
+		// A box can't reach past the box it is in
+		boxSize = min(boxSize, end-offset)
+
+		switch {
+		case bytes.Equal(header[4:], []byte("moov")):
+			return mp4Duration(file, offset+headerSize, offset+boxSize)
+		case bytes.Equal(header[4:], []byte("mvhd")):
+			return mvhdDuration(file, offset+headerSize)
+		}
+
+		offset += boxSize
+	}
+
+	return 0, false
+}
+
+func mvhdDuration(file io.ReaderAt, offset int64) (time.Duration, bool) {
+	box := make([]byte, 32)
+	if _, err := file.ReadAt(box, offset); err != nil {
+		return 0, false
+	}
+
+	var timescale, duration uint64
+	if box[0] == 1 {
+		timescale = uint64(binary.BigEndian.Uint32(box[20:]))
+		duration = binary.BigEndian.Uint64(box[24:])
+	} else {
+		timescale = uint64(binary.BigEndian.Uint32(box[12:]))
+		duration = uint64(binary.BigEndian.Uint32(box[16:]))
+	}
+
+	if timescale == 0 {
+		return 0, false
+	}
+
+	return time.Duration(float64(duration) / float64(timescale) * float64(time.Second)), true
+}
+
+// Bitrates of MPEG audio layer III in kbit/s by the bitrate index, MPEG-2 and MPEG-2.5 share the lower ones
+var (
+	mp3Bitrates    = [16]int{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0}
+	mp3LowBitrates = [16]int{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0}
+	mp3SampleRates = [3]int{44100, 48000, 32000}
+)
+
+// mp3Duration counts the frames from the Xing or VBRI header of the first frame, without one the bitrate of the first frame is taken as constant.
+// Only layer III is read, the other MPEG audio layers have no known duration.
+func mp3Duration(file io.ReaderAt, size int64) (time.Duration, bool) {
+	tag := make([]byte, 10)
+	if _, err := file.ReadAt(tag, 0); err != nil {
+		return 0, false
+	}
+
+	// The ID3v2 tag in front of the audio stores its size in 7 bits of each byte
+	var start int64
+	if string(tag[:3]) == "ID3" {
+		tagSize := int64(tag[6]&0x7F)<<21 | int64(tag[7]&0x7F)<<14 | int64(tag[8]&0x7F)<<7 | int64(tag[9]&0x7F)
+		start = 10 + tagSize
+		if tag[5]&0x10 != 0 {
+			start += 10
+		}
+	}
+
+	frame := make([]byte, 64)
+	if _, err := file.ReadAt(frame, start); err != nil {
+		return 0, false
+	}
+	if frame[0] != 0xFF || frame[1]&0xE0 != 0xE0 {
+		return 0, false
+	}
+
+	// Version 3 is MPEG-1, 2 is MPEG-2 and 0 is MPEG-2.5, layer 1 is layer III
+	version := frame[1] >> 3 & 3
+	layer := frame[1] >> 1 & 3
+	sampleRateIndex := frame[2] >> 2 & 3
+	mono := frame[3]>>6 == 3
+	if version == 1 || layer != 1 || sampleRateIndex == 3 {
+		return 0, false
+	}
+
+	sampleRate := mp3SampleRates[sampleRateIndex]
+	samplesPerFrame := 1152
+	bitrates := mp3Bitrates
+	sideInfoSize := 32
+	if mono {
+		sideInfoSize = 17
+	}
+	if version != 3 {
+		sampleRate /= 2
+		if version == 0 {
+			sampleRate /= 2
+		}
+		samplesPerFrame = 576
+		bitrates = mp3LowBitrates
+		sideInfoSize = 17
+		if mono {
+			sideInfoSize = 9
+		}
+	}
+
+	framesDuration := func(frames uint32) time.Duration {
+		return time.Duration(float64(frames) * float64(samplesPerFrame) / float64(sampleRate) * float64(time.Second))
+	}
+
+	// The Xing header only has the frame count when its first flag is set
+	xing := frame[4+sideInfoSize:]
+	if tag := string(xing[:4]); (tag == "Xing" || tag == "Info") && binary.BigEndian.Uint32(xing[4:])&1 != 0 {
+		return framesDuration(binary.BigEndian.Uint32(xing[8:])), true
+	}
+
+	if vbri := frame[36:]; string(vbri[:4]) == "VBRI" {
+		return framesDuration(binary.BigEndian.Uint32(vbri[14:])), true
+	}
+
+	bitrate := bitrates[frame[2]>>4]
+	if bitrate == 0 {
+		return 0, false
+	}
+
+	// An ID3v1 tag at the end isn't audio
+	audioSize := size - start
+	if audioSize >= 128 {
+		if _, err := file.ReadAt(tag[:3], size-128); err == nil && string(tag[:3]) == "TAG" {
+			audioSize -= 128
+		}
+	}
+
+	return time.Duration(float64(audioSize) * 8 / float64(bitrate*1000) * float64(time.Second)), true
+}
+
+// Opus always counts its granule positions at this rate
+const opusGranuleRate = 48000
+
+// Ogg pages are at most this long
+const maxOggPageSize = 27 + 255 + 255*255
+
+// oggDuration divides the granule position of the last page by the sample rate from the identification header on the first page.
+// Only Vorbis and Opus streams are read.
+func oggDuration(file io.ReaderAt, size int64) (time.Duration, bool) {
+	page := make([]byte, 27)
+	if _, err := file.ReadAt(page, 0); err != nil || string(page[:4]) != "OggS" {
+		return 0, false
+	}
+
+	// The first packet starts right after the segment table
+	packet := make([]byte, 19)
+	if _, err := file.ReadAt(packet, 27+int64(page[26])); err != nil {
+		return 0, false
+	}
+
+	var rate, preSkip int64
+	switch {
+	case packet[0] == 1 && string(packet[1:7]) == "vorbis":
+		rate = int64(binary.LittleEndian.Uint32(packet[12:]))
+	case string(packet[:8]) == "OpusHead":
+		rate = opusGranuleRate
+		preSkip = int64(binary.LittleEndian.Uint16(packet[10:]))
+	default:
+		return 0, false
+	}
+	if rate == 0 {
+		return 0, false
+	}
+
+	tail := make([]byte, min(size, maxOggPageSize))
+	if _, err := file.ReadAt(tail, size-int64(len(tail))); err != nil {
+		return 0, false
+	}
+
+	// Pages where no packet ends have no granule position, the one before them has
+	capture := []byte("OggS")
+	for i := bytes.LastIndex(tail, capture); i >= 0; i = bytes.LastIndex(tail[:i], capture) {
+		if i+27 > len(tail) || tail[i+4] != 0 {
+			continue
+		}
+
+		granule := int64(binary.LittleEndian.Uint64(tail[i+6:]))
+		if granule < 0 {
+			continue
+		}
+		if granule < preSkip {
+			return 0, false
+		}
+
+		return time.Duration(float64(granule-preSkip) / float64(rate) * float64(time.Second)), true
+	}
+
+	return 0, false
+}
+
+// EBML ids of the elements on the way to the duration of a WebM file
+const (
+	ebmlSegment       = 0x18538067
+	ebmlInfo          = 0x1549A966
+	ebmlTimecodeScale = 0x2AD7B1
+	ebmlDuration      = 0x4489
+
+	// Timestamps are in milliseconds unless the file says otherwise
+	defaultTimecodeScale = 1000000
+)
+
+// webmDuration reads the duration from the info of the segment, it is in units of the timecode scale.
+// Files recorded as a stream often have no duration, those are left unknown.
+func webmDuration(file io.ReaderAt, size int64) (time.Duration, bool) {
+	segmentStart, segmentEnd, ok := ebmlFind(file, 0, size, ebmlSegment)
+	if !ok {
+		return 0, false
+	}
+
+	infoStart, infoEnd, ok := ebmlFind(file, segmentStart, segmentEnd, ebmlInfo)
+	if !ok {
+		return 0, false
+	}
+
+	timecodeScale := uint64(defaultTimecodeScale)
+	var duration float64
+	for offset := infoStart; offset < infoEnd; {
+		id, dataStart, dataSize, ok := ebmlElement(file, offset)
+		if !ok || dataSize < 0 || dataStart+dataSize > infoEnd {
+			return 0, false
+		}
+
+		switch id {
+		case ebmlTimecodeScale:
+			if dataSize == 0 || dataSize > 8 {
+				return 0, false
+			}
+			data := make([]byte, 8)
+			if _, err := file.ReadAt(data[8-dataSize:], dataStart); err != nil {
+				return 0, false
+			}
+			timecodeScale = binary.BigEndian.Uint64(data)
+		case ebmlDuration:
+			if dataSize != 4 && dataSize != 8 {
+				return 0, false
+			}
+			data := make([]byte, dataSize)
+			if _, err := file.ReadAt(data, dataStart); err != nil {
+				return 0, false
+			}
+			if dataSize == 4 {
+				duration = float64(math.Float32frombits(binary.BigEndian.Uint32(data)))
+			} else {
+				duration = math.Float64frombits(binary.BigEndian.Uint64(data))
+			}
+		}
+
+		offset = dataStart + dataSize
+	}
+
+	nanoseconds := duration * float64(timecodeScale)
+	if !(nanoseconds > 0) || nanoseconds > math.MaxInt64 {
+		return 0, false
+	}
+
+	return time.Duration(nanoseconds), true
+}
+
+// ebmlFind returns where the data of the first element with the id between start and end begins and ends.
+// Elements of unknown size can't be skipped, the search stops at them unless they are the one searched for.
+func ebmlFind(file io.ReaderAt, start int64, end int64, wanted int64) (int64, int64, bool) {
+	for offset := start; offset < end; {
+		id, dataStart, dataSize, ok := ebmlElement(file, offset)
+		if !ok {
+			return 0, 0, false
+		}
+
+		if id == wanted {
+			if dataSize < 0 {
+				return dataStart, end, true
+			}
+			return dataStart, min(dataStart+dataSize, end), true
+		}
+
+		if dataSize < 0 {
+			return 0, 0, false
+		}
+		offset = dataStart + dataSize
+	}
+
+	return 0, 0, false
+}
+
+// ebmlElement reads the id and the size of the element at the offset, the size is -1 when it is unknown
+func ebmlElement(file io.ReaderAt, offset int64) (int64, int64, int64, bool) {
+	id, idLength, ok := ebmlVint(file, offset, true)
+	if !ok {
+		return 0, 0, 0, false
+	}
+
+	dataSize, sizeLength, ok := ebmlVint(file, offset+idLength, false)
+	if !ok {
+		return 0, 0, 0, false
+	}
+
+	return id, offset + idLength + sizeLength, dataSize, true
+}
+
+// ebmlVint reads a variable length integer, ids keep their length marker and sizes drop it.
+// A size of all ones means unknown and is returned as -1.
+func ebmlVint(file io.ReaderAt, offset int64, keepMarker bool) (int64, int64, bool) {
+	first := make([]byte, 1)
+	if _, err := file.ReadAt(first, offset); err != nil {
+		return 0, 0, false
+	}
+
+	length := bits.LeadingZeros8(first[0]) + 1
+	if length > 8 {
+		return 0, 0, false
+	}
+
+	data := make([]byte, length)
+	if _, err := file.ReadAt(data, offset); err != nil {
+		return 0, 0, false
+	}
+
+	value := int64(data[0])
+	if !keepMarker {
+		value &= 0xFF >> length
+	}
+	unknown := !keepMarker && value == 0xFF>>length
+	for _, b := range data[1:] {
+		value = value<<8 | int64(b)
+		unknown = unknown && b == 0xFF
+	}
+
+	if unknown {
+		return -1, int64(length), true
+	}
+
+	return value, int64(length), true
+}
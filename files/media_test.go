@@ -0,0 +1,365 @@
+package files
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		name        string
+		head        []byte
+		contentType string
+		ok          bool
+	}{
+		{"png", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR"), "image/png", true},
+		{"jpeg", []byte("\xFF\xD8\xFF\xE0\x00\x10JFIF"), "image/jpeg", true},
+		{"mp3 with id3", []byte("ID3\x03\x00\x00\x00\x00\x00\x14"), "audio/mpeg", true},
+		{"mp3 frame", []byte{0xFF, 0xFB, 0x90, 0x00, 0x00, 0x00}, "audio/mpeg", true},
+		{"wav", []byte("RIFF\x24\x00\x00\x00WAVEfmt "), "audio/wav", true},
+		{"ogg", []byte("OggS\x00\x02\x00\x00\x00\x00\x00\x00\x00\x00"), "audio/ogg", true},
+		{"mp4", box("ftyp", []byte("mp42\x00\x00\x00\x00mp42isom")), "video/mp4", true},
+		{"m4a", box("ftyp", []byte("M4A \x00\x00\x00\x00M4A mp42")), "audio/mp4", true},
+		{"webm", []byte("\x1A\x45\xDF\xA3\x9F\x42\x86\x81\x01\x42\x82\x84webm"), "video/webm", true},
+		{"text", []byte("hello world"), "", false},
+		{"empty", []byte{}, "", false},
+		{"single sync byte", []byte{0xFF}, "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			format, err := detectFormat(test.head)
+			if (err == nil) != test.ok {
+				t.Fatalf("got error %v, want ok %v", err, test.ok)
+			}
+			if format.ContentType != test.contentType {
+				t.Errorf("got %q, want %q", format.ContentType, test.contentType)
+			}
+		})
+	}
+}
+
+func chunk(id string, data []byte) []byte {
+	out := append([]byte(id), le32(uint32(len(data)))...)
+	out = append(out, data...)
+	if len(data)%2 == 1 {
+		out = append(out, 0)
+	}
+	return out
+}
+
+func wavFile(chunks ...[]byte) []byte {
+	body := []byte("WAVE")
+	for _, c := range chunks {
+		body = append(body, c...)
+	}
+	return append(append([]byte("RIFF"), le32(uint32(len(body)))...), body...)
+}
+
+func wavFmt(byteRate uint32) []byte {
+	format := make([]byte, 16)
+	binary.LittleEndian.PutUint16(format[0:], 1)
+	binary.LittleEndian.PutUint16(format[2:], 1)
+	binary.LittleEndian.PutUint32(format[4:], byteRate)
+	binary.LittleEndian.PutUint32(format[8:], byteRate)
+	return chunk("fmt ", format)
+}
+
+func TestWavDuration(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     []byte
+		duration time.Duration
+		ok       bool
+	}{
+		{"fmt then data", wavFile(wavFmt(4), chunk("data", make([]byte, 8))), 2 * time.Second, true},
+		{"data then fmt", wavFile(chunk("data", make([]byte, 8)), wavFmt(4)), 2 * time.Second, true},
+		{"odd chunk padded", wavFile(chunk("LIST", []byte("abc")), wavFmt(4), chunk("data", make([]byte, 8))), 2 * time.Second, true},
+		{"no data", wavFile(wavFmt(4)), 0, false},
+		{"zero byte rate", wavFile(wavFmt(0), chunk("data", make([]byte, 8))), 0, false},
+		{"truncated fmt", wavFile([]byte("fmt \x10\x00\x00\x00\x01\x00")), 0, false},
+		{"oversized chunk", wavFile(chunk("LIST", nil)[:4], le32(math.MaxUint32), wavFmt(4), chunk("data", make([]byte, 8))), 0, false},
+		{"header only", []byte("RIFF\x04\x00\x00\x00WAVE"), 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			duration, ok := wavDuration(bytes.NewReader(test.file), int64(len(test.file)))
+			if ok != test.ok || duration != test.duration {
+				t.Errorf("got %v %v, want %v %v", duration, ok, test.duration, test.ok)
+			}
+		})
+	}
+}
+
+func box(kind string, payload ...[]byte) []byte {
+	data := bytes.Join(payload, nil)
+	return append(append(be32(uint32(8+len(data))), kind...), data...)
+}
+
+func mvhd(version byte, timescale uint32, duration uint64) []byte {
+	data := make([]byte, 100)
+	data[0] = version
+	if version == 1 {
+		binary.BigEndian.PutUint32(data[20:], timescale)
+		binary.BigEndian.PutUint64(data[24:], duration)
+	} else {
+		binary.BigEndian.PutUint32(data[12:], timescale)
+		binary.BigEndian.PutUint32(data[16:], uint32(duration))
+	}
+	return box("mvhd", data)
+}
+
+func TestMp4Duration(t *testing.T) {
+	ftyp := box("ftyp", []byte("mp42\x00\x00\x00\x00mp42isom"))
+	largeMdat := append(append(be32(1), "mdat"...), be64(24)...)
+	largeMdat = append(largeMdat, make([]byte, 8)...)
+	oversizedMoov := append(be32(1<<30), append([]byte("moov"), mvhd(0, 1000, 5000)...)...)
+	sizeToEnd := append(be32(0), append([]byte("moov"), mvhd(0, 1000, 5000)...)...)
+
+	tests := []struct {
+		name     string
+		file     []byte
+		duration time.Duration
+		ok       bool
+	}{
+		{"version 0", concat(ftyp, box("moov", mvhd(0, 1000, 5000))), 5 * time.Second, true},
+		{"version 1", concat(ftyp, box("moov", mvhd(1, 600, 1500))), 2500 * time.Millisecond, true},
+		{"moov after mdat", concat(ftyp, box("mdat", make([]byte, 32)), box("moov", mvhd(0, 1000, 5000))), 5 * time.Second, true},
+		{"mvhd after trak", concat(ftyp, box("moov", box("trak", make([]byte, 16)), mvhd(0, 1000, 5000))), 5 * time.Second, true},
+		{"large size box", concat(ftyp, largeMdat, box("moov", mvhd(0, 1000, 5000))), 5 * time.Second, true},
+		{"box to the end", concat(ftyp, sizeToEnd), 5 * time.Second, true},
+		{"oversized moov", concat(ftyp, oversizedMoov), 5 * time.Second, true},
+		{"no moov", ftyp, 0, false},
+		{"no mvhd", concat(ftyp, box("moov", box("trak"))), 0, false},
+		{"zero timescale", concat(ftyp, box("moov", mvhd(0, 0, 5000))), 0, false},
+		{"truncated mvhd", concat(ftyp, box("moov", mvhd(0, 1000, 5000)))[:len(ftyp)+8+8+10], 0, false},
+		{"box smaller than header", concat(ftyp, be32(4), []byte("moov")), 0, false},
+		{"oversized mdat", concat(ftyp, be32(1<<20), []byte("mdat"), box("moov", mvhd(0, 1000, 5000))), 0, false},
+		{"negative large size", concat(ftyp, be32(1), []byte("mdat"), be64(math.MaxUint64)), 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			duration, ok := mp4Duration(bytes.NewReader(test.file), 0, int64(len(test.file)))
+			if ok != test.ok || duration != test.duration {
+				t.Errorf("got %v %v, want %v %v", duration, ok, test.duration, test.ok)
+			}
+		})
+	}
+}
+
+func TestMvhdDuration(t *testing.T) {
+	tests := []struct {
+		name     string
+		box      []byte
+		duration time.Duration
+		ok       bool
+	}{
+		{"version 0", mvhd(0, 1000, 1500)[8:], 1500 * time.Millisecond, true},
+		{"version 1", mvhd(1, 90000, 270000)[8:], 3 * time.Second, true},
+		{"zero timescale", mvhd(1, 0, 270000)[8:], 0, false},
+		{"short box", mvhd(0, 1000, 1500)[8:30], 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			duration, ok := mvhdDuration(bytes.NewReader(test.box), 0)
+			if ok != test.ok || duration != test.duration {
+				t.Errorf("got %v %v, want %v %v", duration, ok, test.duration, test.ok)
+			}
+		})
+	}
+}
+
+// mp3Frame is a frame with the header bytes and the tag at the offset, padded to a typical frame size
+func mp3Frame(header []byte, offset int, tag []byte) []byte {
+	frame := make([]byte, 417)
+	copy(frame, header)
+	copy(frame[offset:], tag)
+	return frame
+}
+
+func xingTag(frames uint32) []byte {
+	return concat([]byte("Xing"), be32(1), be32(frames))
+}
+
+func id3Tag(size int) []byte {
+	tag := []byte{'I', 'D', '3', 3, 0, 0, byte(size >> 21 & 0x7F), byte(size >> 14 & 0x7F), byte(size >> 7 & 0x7F), byte(size & 0x7F)}
+	return append(tag, make([]byte, size)...)
+}
+
+func TestMp3Duration(t *testing.T) {
+	// MPEG-1 layer III, 128 kbit/s, 44.1 kHz, stereo
+	stereo := []byte{0xFF, 0xFB, 0x90, 0x00}
+	// MPEG-2 layer III, 80 kbit/s, 22.05 kHz, mono
+	mono := []byte{0xFF, 0xF3, 0x90, 0xC0}
+
+	framesDuration := func(frames int, samples int, rate int) time.Duration {
+		return time.Duration(float64(frames) * float64(samples) / float64(rate) * float64(time.Second))
+	}
+
+	cbr := concat(mp3Frame(stereo, 4, nil), make([]byte, 16000-417))
+	vbri := concat([]byte("VBRI"), make([]byte, 10), be32(50))
+
+	tests := []struct {
+		name     string
+		file     []byte
+		duration time.Duration
+		ok       bool
+	}{
+		{"xing", mp3Frame(stereo, 36, xingTag(100)), framesDuration(100, 1152, 44100), true},
+		{"info", mp3Frame(stereo, 36, concat([]byte("Info"), be32(1), be32(10))), framesDuration(10, 1152, 44100), true},
+		{"xing mpeg-2 mono", mp3Frame(mono, 13, xingTag(100)), framesDuration(100, 576, 22050), true},
+		{"vbri", mp3Frame(stereo, 36, vbri), framesDuration(50, 1152, 44100), true},
+		{"xing after id3", concat(id3Tag(20), mp3Frame(stereo, 36, xingTag(100))), framesDuration(100, 1152, 44100), true},
+		{"constant bitrate", cbr, time.Second, true},
+		{"constant bitrate with tags", concat(id3Tag(300), cbr, []byte("TAG"), make([]byte, 125)), time.Second, true},
+		{"xing without frame count", concat(mp3Frame(stereo, 36, concat([]byte("Xing"), be32(0))), make([]byte, 16000-417)), time.Second, true},
+		{"layer ii", mp3Frame([]byte{0xFF, 0xFD, 0x90, 0x00}, 36, xingTag(100)), 0, false},
+		{"reserved version", mp3Frame([]byte{0xFF, 0xEB, 0x90, 0x00}, 36, xingTag(100)), 0, false},
+		{"free bitrate", mp3Frame([]byte{0xFF, 0xFB, 0x00, 0x00}, 4, nil), 0, false},
+		{"no frame sync", mp3Frame([]byte{0x00, 0x00, 0x00, 0x00}, 36, xingTag(100)), 0, false},
+		{"truncated frame", stereo, 0, false},
+		{"oversized id3", concat(id3Tag(1 << 20)[:10], mp3Frame(stereo, 36, xingTag(100))), 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			duration, ok := mp3Duration(bytes.NewReader(test.file), int64(len(test.file)))
+			if ok != test.ok || duration != test.duration {
+				t.Errorf("got %v %v, want %v %v", duration, ok, test.duration, test.ok)
+			}
+		})
+	}
+}
+
+func oggPage(granule int64, packet []byte) []byte {
+	page := concat([]byte("OggS"), []byte{0, 0}, le64(uint64(granule)), make([]byte, 12))
+	var segments []byte
+	for remaining := len(packet); ; remaining -= 255 {
+		segments = append(segments, byte(min(remaining, 255)))
+		if remaining < 255 {
+			break
+		}
+	}
+	page = append(page, byte(len(segments)))
+	return concat(page, segments, packet)
+}
+
+func TestOggDuration(t *testing.T) {
+	vorbis := oggPage(0, concat([]byte("\x01vorbis"), le32(0), []byte{2}, le32(44100), make([]byte, 14)))
+	opus := oggPage(0, concat([]byte("OpusHead"), []byte{1, 2}, le16(312), le32(48000), make([]byte, 3)))
+
+	tests := []struct {
+		name     string
+		file     []byte
+		duration time.Duration
+		ok       bool
+	}{
+		{"vorbis", concat(vorbis, oggPage(0, make([]byte, 40)), oggPage(88200, make([]byte, 300))), 2 * time.Second, true},
+		{"opus", concat(opus, oggPage(96312, make([]byte, 100))), 2 * time.Second, true},
+		{"last page without granule", concat(vorbis, oggPage(44100, make([]byte, 10)), oggPage(-1, make([]byte, 10))), time.Second, true},
+		{"only header", vorbis, 0, true},
+		{"unknown codec", concat(oggPage(0, []byte("\x80theora"+string(make([]byte, 20)))), oggPage(100, nil)), 0, false},
+		{"granule before pre-skip", concat(opus, oggPage(100, nil)), 0, false},
+		{"zero sample rate", concat(oggPage(0, concat([]byte("\x01vorbis"), make([]byte, 20))), oggPage(100, nil)), 0, false},
+		{"truncated header", vorbis[:30], 0, false},
+		{"not ogg", []byte("RIFF\x00\x00\x00\x00WAVE" + string(make([]byte, 40))), 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			duration, ok := oggDuration(bytes.NewReader(test.file), int64(len(test.file)))
+			if ok != test.ok || duration != test.duration {
+				t.Errorf("got %v %v, want %v %v", duration, ok, test.duration, test.ok)
+			}
+		})
+	}
+}
+
+// element is an EBML element with its size written in eight bytes
+func element(id []byte, data ...[]byte) []byte {
+	payload := bytes.Join(data, nil)
+	size := be64(uint64(len(payload)))
+	size[0] = 0x01
+	return concat(id, size, payload)
+}
+
+func unknownSize(id []byte, data ...[]byte) []byte {
+	return concat(id, []byte{0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}, bytes.Join(data, nil))
+}
+
+func TestWebmDuration(t *testing.T) {
+	var (
+		ebmlHeader    = element([]byte{0x1A, 0x45, 0xDF, 0xA3}, element([]byte{0x42, 0x82}, []byte("webm")))
+		segment       = []byte{0x18, 0x53, 0x80, 0x67}
+		info          = []byte{0x15, 0x49, 0xA9, 0x66}
+		cluster       = []byte{0x1F, 0x43, 0xB6, 0x75}
+		timecodeScale = []byte{0x2A, 0xD7, 0xB1}
+		duration      = []byte{0x44, 0x89}
+		title         = []byte{0x7B, 0xA9}
+	)
+
+	scale := element(timecodeScale, []byte{0x0F, 0x42, 0x40})
+	float64Duration := element(duration, be64(math.Float64bits(2500)))
+	float32Duration := element(duration, be32(math.Float32bits(2500)))
+
+	tests := []struct {
+		name     string
+		file     []byte
+		duration time.Duration
+		ok       bool
+	}{
+		{"float64 duration", concat(ebmlHeader, element(segment, element(info, scale, float64Duration))), 2500 * time.Millisecond, true},
+		{"float32 duration", concat(ebmlHeader, element(segment, element(info, scale, float32Duration))), 2500 * time.Millisecond, true},
+		{"default timecode scale", concat(ebmlHeader, element(segment, element(info, element(title, []byte("x")), float64Duration))), 2500 * time.Millisecond, true},
+		{"custom timecode scale", concat(ebmlHeader, element(segment, element(info, element(timecodeScale, []byte{0x01}), float64Duration))), 2500 * time.Nanosecond, true},
+		{"unknown segment size", concat(ebmlHeader, unknownSize(segment, element(info, scale, float64Duration), unknownSize(cluster))), 2500 * time.Millisecond, true},
+		{"no duration", concat(ebmlHeader, element(segment, element(info, scale))), 0, false},
+		{"no info", concat(ebmlHeader, element(segment, element(cluster))), 0, false},
+		{"unknown size before info", concat(ebmlHeader, unknownSize(segment, unknownSize(cluster), element(info, float64Duration))), 0, false},
+		{"duration of two bytes", concat(ebmlHeader, element(segment, element(info, element(duration, []byte{1, 2})))), 0, false},
+		{"negative duration", concat(ebmlHeader, element(segment, element(info, element(duration, be64(math.Float64bits(-1)))))), 0, false},
+		{"truncated info", concat(ebmlHeader, element(segment, element(info, scale, float64Duration)))[:len(ebmlHeader)+12+12+20], 0, false},
+		{"oversized element before info", concat(ebmlHeader, element(segment, concat(cluster, []byte{0x01, 0x00, 0x00, 0x00, 0x10, 0x00, 0x00, 0x00}), element(info, float64Duration))), 0, false},
+		{"child past info", concat(ebmlHeader, element(segment, concat(info, []byte{0x81}), float64Duration)), 0, false},
+		{"invalid vint", concat(ebmlHeader, []byte{0x00, 0x00}), 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			duration, ok := webmDuration(bytes.NewReader(test.file), int64(len(test.file)))
+			if ok != test.ok || duration != test.duration {
+				t.Errorf("got %v %v, want %v %v", duration, ok, test.duration, test.ok)
+			}
+		})
+	}
+}
+
+func concat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+func le16(value uint16) []byte {
+	return binary.LittleEndian.AppendUint16(nil, value)
+}
+
+func le32(value uint32) []byte {
+	return binary.LittleEndian.AppendUint32(nil, value)
+}
+
+func le64(value uint64) []byte {
+	return binary.LittleEndian.AppendUint64(nil, value)
+}
+
+func be32(value uint32) []byte {
+	return binary.BigEndian.AppendUint32(nil, value)
+}
+
+func be64(value uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, value)
+}
@@ -0,0 +1,89 @@
+package game
+
+import (
+	"recognizer/db"
+	"sort"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Share of distractors picked at random, so items nobody confused yet still get shown
+const confusionExploration = 0.3
+
+// RecordConfusion counts a wrong answer where the item was taken for the other one
+func RecordConfusion(tx *gorm.DB, item *db.Item, confusedWithId uint) error {
+	if confusedWithId == 0 || confusedWithId == item.ID {
+		return nil
+	}
+
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "item_id"}, {Name: "confused_with_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{"count": gorm.Expr("confusions.count + 1")}),
+	}).Create(&db.Confusion{
+		ExamID:         item.ExamID,
+		ItemID:         item.ID,
+		ConfusedWithID: confusedWithId,
+		Count:          1,
+	}).Error
+}
+
+// LoadConfusions returns how many times the item was mixed up with each other item, in both directions
+func LoadConfusions(tx *gorm.DB, itemId uint) (map[uint]int, error) {
+	var rows []db.Confusion
+	err := tx.Where("item_id = ? OR confused_with_id = ?", itemId, itemId).Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	confusions := make(map[uint]int, len(rows))
+	for _, row := range rows {
+		if row.ItemID == itemId {
+			confusions[row.ConfusedWithID] += row.Count
+		} else {
+			confusions[row.ItemID] += row.Count
+		}
+	}
+
+	return confusions, nil
+}
+
+// FindItemByName looks for the item of the exam a wrong name answer belongs to, preferring the group of the asked item
+func FindItemByName(exam *db.Exam, items []*db.Item, asked *db.Item, name string) *db.Item {
+	name = foldAnswer(exam, name)
+
+	var found *db.Item
+	for _, item := range items {
+		if item.ID == asked.ID || foldAnswer(exam, item.Name) != name {
+			continue
+		}
+
+		if item.GroupID == asked.GroupID {
+			return item
+		}
+
+		if found == nil {
+			found = item
+		}
+	}
+
+	return found
+}
+
+// pickConfused fills the picker with the items most often mixed up with the asked one and random group siblings
+func pickConfused(picker *distractorPicker, random Random, siblings []*db.Item, confused []*db.Item, confusions map[uint]int) {
+	sort.SliceStable(confused, func(i, j int) bool {
+		return confusions[confused[i].ID] > confusions[confused[j].ID]
+	})
+
+	for !picker.full() {
+		explore := random.Float64() < confusionExploration
+		if explore && picker.takeFirst(siblings) {
+			continue
+		}
+		if picker.takeFirst(confused) || picker.takeFirst(siblings) {
+			continue
+		}
+		break
+	}
+}
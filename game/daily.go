@@ -0,0 +1,119 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"recognizer/db"
+	"recognizer/types"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const dailyChallengeSize = 10
+
+var errNoItems = errors.New("No items in this exam")
+
+func (service *Service) StartDailyChallenge(c *gin.Context) {
+	examIdParam, err := strconv.ParseUint(c.Param("examId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	foundExam, err := service.findExam(c, uint(examIdParam))
+	if err != nil {
+		return
+	}
+
+	challenge, err := service.dailyChallenge(foundExam, time.Now().UTC().Format(types.DailyDateFormat))
+	if errors.Is(err, errNoItems) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating daily challenge"})
+		return
+	}
+
+	userId := c.MustGet("userId").(uint)
+
+	var playedSession db.GameSession
+	res := service.DB.Where("challenge_id = ? AND user_id = ?", challenge.ID, userId).First(&playedSession)
+	if res.Error == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "You already played today's challenge", "sessionId": playedSession.ID})
+		return
+	}
+
+	session := db.GameSession{
+		UserID:      userId,
+		ExamID:      foundExam.ID,
+		ChallengeID: &challenge.ID,
+	}
+
+	// The unique index stops a second session started at the same time
+	if err := service.startSession(&session, challenge.ItemIDs); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "You already played today's challenge"})
+		return
+	}
+
+	c.JSON(http.StatusOK, newSessionReport(&session, time.Now()))
+}
+
+// dailyChallenge returns the challenge of the exam for the date and creates it on first use.
+// The questions are drawn with a generator seeded from the exam and the date, so they can be reproduced.
+func (service *Service) dailyChallenge(exam *db.Exam, date string) (*db.DailyChallenge, error) {
+	var challenge db.DailyChallenge
+	res := service.DB.Where("exam_id = ? AND date = ?", exam.ID, date).First(&challenge)
+
+	if res.Error == nil {
+		return &challenge, nil
+	}
+
+	if !errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		return nil, res.Error
+	}
+
+	var items []*db.Item
+	service.DB.Where("exam_id = ?", exam.ID).Order("id").Find(&items)
+
+	if len(items) == 0 {
+		return nil, errNoItems
+	}
+
+	seed := dailySeed(exam.ID, date)
+	shuffleItems(seededRandom(seed), items)
+
+	challenge = db.DailyChallenge{
+		ExamID: exam.ID,
+		Date:   date,
+		Seed:   seed,
+	}
+	for _, item := range items[:min(dailyChallengeSize, len(items))] {
+		challenge.ItemIDs = append(challenge.ItemIDs, item.ID)
+	}
+
+	// Someone else may have created it in the meantime, theirs is the same anyway
+	err := service.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&challenge).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if challenge.ID == 0 {
+		err = service.DB.Where("exam_id = ? AND date = ?", exam.ID, date).First(&challenge).Error
+	}
+
+	return &challenge, err
+}
+
+func dailySeed(examId uint, date string) int64 {
+	hash := fnv.New64a()
+	fmt.Fprintf(hash, "%d:%s", examId, date)
+
+	return int64(hash.Sum64())
+}
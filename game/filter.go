@@ -0,0 +1,64 @@
+package game
+
+import (
+	"fmt"
+	"recognizer/db"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// parseFilter reads the practice filter from the query, groups have to belong to the exam.
+// No filter returns nil.
+func (service *Service) parseFilter(c *gin.Context, exam *db.Exam) (*db.PracticeFilter, error) {
+	groupsParam := c.Query("groups")
+	if groupsParam == "" {
+		return nil, nil
+	}
+
+	var examGroups []db.Group
+	service.DB.Where("exam_id = ?", exam.ID).Find(&examGroups)
+
+	inExam := make(map[uint]bool, len(examGroups))
+	for _, group := range examGroups {
+		inExam[group.ID] = true
+	}
+
+	filter := &db.PracticeFilter{}
+	seen := map[uint]bool{}
+	for _, part := range strings.Split(groupsParam, ",") {
+		groupId, err := strconv.ParseUint(strings.TrimSpace(part), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid group id %q", part)
+		}
+
+		if !inExam[uint(groupId)] {
+			return nil, fmt.Errorf("Group %d is not part of this exam", groupId)
+		}
+
+		if !seen[uint(groupId)] {
+			seen[uint(groupId)] = true
+			filter.GroupIDs = append(filter.GroupIDs, uint(groupId))
+		}
+	}
+
+	sort.Slice(filter.GroupIDs, func(i, j int) bool { return filter.GroupIDs[i] < filter.GroupIDs[j] })
+
+	return filter, nil
+}
+
+// applyFilter narrows an item query down to the filter
+func applyFilter(query *gorm.DB, filter *db.PracticeFilter) *gorm.DB {
+	if filter == nil {
+		return query
+	}
+
+	if len(filter.GroupIDs) > 0 {
+		query = query.Where("group_id IN ?", filter.GroupIDs)
+	}
+
+	return query
+}
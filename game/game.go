@@ -1,21 +1,47 @@
 package game
 
 import (
-	"math/rand"
+	"errors"
 	"net/http"
+	"recognizer/access"
 	"recognizer/db"
+	"recognizer/rating"
+	"recognizer/review"
+	"recognizer/scoring"
 	"recognizer/types"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
+// Answers arriving this late after the time limit are still in time, to make up for network latency
+const timeLimitGraceMs = 1000
+
 type Service struct {
 	types.ServiceConfig
+	// Picks the items and builds the questions, can be replaced to make them reproducible
+	Random Random
 }
 
 func NewGameService(config types.ServiceConfig) Service {
-	return Service{config}
+	return Service{config, globalRandom{}}
+}
+
+// findExam loads the exam if the user can play it and writes the error response when they can't
+func (service *Service) findExam(c *gin.Context, examId uint) (*db.Exam, error) {
+	foundExam, err := access.FindExam(service.DB, examId, c.MustGet("userId").(uint))
+	if errors.Is(err, access.ErrExamNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return nil, err
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading exam"})
+		return nil, err
+	}
+
+	return foundExam, nil
 }
 
 func (service *Service) GetItem(c *gin.Context) {
@@ -25,44 +51,74 @@ func (service *Service) GetItem(c *gin.Context) {
 		return
 	}
 
+	foundExam, err := service.findExam(c, uint(examIdParam))
+	if err != nil {
+		return
+	}
+
+	// Questions and distractors only come from the filtered items
+	filter, err := service.parseFilter(c, foundExam)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// A type the exam gives no weight can't be asked for
+	questionType := c.Query("type")
+	if questionType != "" && !questionTypeEnabled(foundExam.QuestionTypes, questionType) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Question type isn't enabled for this exam"})
+		return
+	}
+
 	var items []*db.Item
-	service.DB.Where("exam_id = ?", uint(examIdParam)).Find(&items)
+	applyFilter(service.DB.Where("exam_id = ?", foundExam.ID), filter).Find(&items)
 
 	if len(items) == 0 {
 		c.JSON(http.StatusNotFound, gin.H{"error": "No items in this exam"})
 		return
 	}
 
-	randomIndex := rand.Intn(len(items))
-	randomItem := items[randomIndex]
-
-	var similarAnswers []string
-	for itemIndex, item := range items {
-		if itemIndex != randomIndex && item.GroupID == randomItem.GroupID {
-			similarAnswers = append(similarAnswers, item.Name)
+	var randomItem *db.Item
+	switch c.DefaultQuery("mode", "random") {
+	case "random":
+		randomItem = items[service.Random.Intn(len(items))]
+	case "review":
+		// Pick the item the spaced repetition scheduler wants to see next
+		randomItem, err = review.PickDue(service.DB, c.MustGet("userId").(uint), uint(examIdParam), items, time.Now())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading review schedule"})
+			return
 		}
+	case "adaptive":
+		// Aim for items the player answers right about 70% of the time
+		randomItem, err = rating.PickAdaptive(service.DB, c.MustGet("userId").(uint), foundExam.ID, items)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading rating"})
+			return
+		}
+	case "mistakes":
+		// Only items the user recently got wrong
+		randomItem, err = service.pickMistake(c.MustGet("userId").(uint), foundExam.ID, items)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading mistakes"})
+			return
+		}
+		if randomItem == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No mistakes to practice"})
+			return
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown game mode"})
+		return
 	}
 
-	// Now we'll shuffle these elements
-	rand.Shuffle(len(similarAnswers), func(i, j int) { similarAnswers[i], similarAnswers[j] = similarAnswers[j], similarAnswers[i] })
-	itemsToGet := len(similarAnswers)
-	if itemsToGet > 3 {
-		itemsToGet = 3
-	}
-
-	answersItems := similarAnswers[:itemsToGet]
-	answersItems = append(answersItems, randomItem.Name)
-
-	// Shuffle the answers
-	rand.Shuffle(len(answersItems), func(i, j int) { answersItems[i], answersItems[j] = answersItems[j], answersItems[i] })
-
-	response := types.GameResponse{
-		ItemId:  randomItem.ID,
-		Image:   randomItem.Image,
-		Answers: answersItems,
+	source, err := service.questionSource(foundExam, items, randomItem, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading confusions"})
+		return
 	}
 
-	c.JSON(http.StatusOK, response)
+	service.respondWithQuestion(c, source, randomItem, filter, questionType)
 }
 
 func (service *Service) GetResult(c *gin.Context) {
@@ -73,18 +129,201 @@ func (service *Service) GetResult(c *gin.Context) {
 		return
 	}
 
+	userId := c.MustGet("userId").(uint)
+
+	// Only answers to questions served to this user are accepted
+	claims, err := parseTicket(data.Ticket)
+	itemId := data.ItemId
+	if err == nil && claims.ItemHash != "" {
+		itemId, err = claims.questionItem()
+	}
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
 	var item *db.Item
-	service.DB.First(&item, data.ItemId)
+	res := service.DB.Preload("Exam").First(&item, itemId)
+
+	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		return
+	}
+
+	// The exam may have been hidden since the question was served
+	if _, err := service.findExam(c, item.ExamID); err != nil {
+		return
+	}
+
+	// Each question type grades its answers by itself
+	var grading Grading
+	err = checkTicket(claims, userId, item.ID)
+	if err == nil {
+		generator, ok := Generator(claims.Type)
+		if !ok {
+			err = errTicketInvalid
+		} else {
+			grading, err = generator.Grade(service.DB, &item.Exam, item, claims.issued(), &data)
+		}
+	}
+	if err == nil {
+		err = service.useTicket(claims)
+	}
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	answer := grading.Answer
+	match := grading.Match
+
+	// Learn which item the wrong answer was taken for
+	if match == types.MatchWrong {
+		confusedWithId := grading.ConfusedWithID
+		if confusedWithId == 0 && grading.ConfusedWithName != "" {
+			var examItems []*db.Item
+			service.DB.Where("exam_id = ?", item.ExamID).Find(&examItems)
+
+			if answerItem := FindItemByName(&item.Exam, examItems, item, grading.ConfusedWithName); answerItem != nil {
+				confusedWithId = answerItem.ID
+			}
+		}
 
-	isCorrect := item.Name == data.Answer
+		err := RecordConfusion(service.DB, item, confusedWithId)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error recording confusion"})
+			return
+		}
+	}
+
+	// Answers after the time limit count as wrong
+	now := time.Now()
+	servedAt := time.UnixMilli(claims.ServedAt)
+	responseMs := now.Sub(servedAt).Milliseconds()
+	timedOut := claims.TimeLimit > 0 && responseMs > int64(claims.TimeLimit)*1000+timeLimitGraceMs
+	if timedOut {
+		match = types.MatchWrong
+	}
+
+	isCorrect := match != types.MatchWrong
+
+	// Answers inside a session have to follow its question order
+	if data.SessionId != nil {
+		err := service.answerSessionQuestion(*data.SessionId, userId, item.ID, answer, isCorrect)
+		if errors.Is(err, errSessionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	// Hints used on the question cost points in the stats
+	var hints []string
+	service.DB.Model(&db.UsedHint{}).Where("ticket_id = ?", claims.Id).Order("id").Pluck("kind", &hints)
+
+	points, err := scoring.Score(service.DB, &item.Exam, userId, scoring.Answer{Correct: isCorrect, ResponseMs: responseMs, Hints: len(hints)}, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error scoring answer"})
+		return
+	}
 
 	scorePoint := db.ScorePoint{
-		UserID: c.MustGet("userId").(uint),
-		ExamID: item.ExamID,
-		ItemID: item.ID,
-		Correct: isCorrect,
+		UserID:         userId,
+		ExamID:         item.ExamID,
+		ItemID:         item.ID,
+		Correct:        isCorrect,
+		SessionID:      data.SessionId,
+		ServedAt:       &servedAt,
+		AnsweredAt:     &now,
+		ResponseMs:     responseMs,
+		TimedOut:       timedOut,
+		Filter:         claims.Filter,
+		Hints:          hints,
+		Points:         points,
+		ScoringVersion: item.Exam.ScoringVersion,
+	}
+	if claims.ImageID != 0 {
+		scorePoint.ImageID = &claims.ImageID
+	}
+	service.DB.Create(&scorePoint)
+
+	// Keep the review schedule in step with the answers
+	if err := review.Record(service.DB, userId, item, isCorrect, now); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating review schedule"})
+		return
+	}
+
+	if err := rating.Record(service.DB, userId, item, isCorrect); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating ratings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"correct": isCorrect, "match": match, "timedOut": timedOut, "responseMs": responseMs, "points": points})
+}
+
+// questionSource prepares the question for the item, a filtered practice never leaves its subset
+func (service *Service) questionSource(exam *db.Exam, items []*db.Item, item *db.Item, filter *db.PracticeFilter) (QuestionSource, error) {
+	source, err := NewQuestionSource(service.DB, exam, items, item)
+	if err != nil {
+		return source, err
+	}
+
+	source.Random = service.Random
+	if filter != nil {
+		source.SharedPool = nil
+	}
+
+	return source, nil
+}
+
+// respondWithQuestion sends the question for the item together with its answer ticket, an empty question type is picked by the weights of the exam
+func (service *Service) respondWithQuestion(c *gin.Context, source QuestionSource, item *db.Item, filter *db.PracticeFilter, questionType string) {
+	// Each question shows one of the images of the item
+	image, err := pickImage(service.DB, source.random(), item)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading images"})
+		return
+	}
+
+	var imageId uint
+	if image != nil {
+		shown := *item
+		shown.Image = image.Image
+		item = &shown
+		imageId = image.ID
+	}
+
+	if questionType == "" {
+		questionType = pickQuestionType(source.random(), source.Exam.QuestionTypes)
+	}
+
+	generator, ok := Generator(questionType)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown question type"})
+		return
+	}
+
+	question, err := generator.Generate(source, item)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	question.TimeLimit = source.Exam.QuestionTimeLimit
+
+	if err := DescribeMedia(service.DB, &question); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading media"})
+		return
+	}
+
+	ticket, err := issueTicket(c.MustGet("userId").(uint), item.ID, imageId, question, filter, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error issuing question ticket"})
+		return
 	}
-	service.DB.Create(scorePoint)
+	question.Ticket = ticket
 
-	c.JSON(http.StatusOK, gin.H{"correct": isCorrect})
+	c.JSON(http.StatusOK, question)
 }
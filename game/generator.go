@@ -0,0 +1,104 @@
+package game
+
+import (
+	"net/http"
+	"recognizer/db"
+	"recognizer/types"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// IssuedQuestion is what the ticket of a question says was asked
+type IssuedQuestion struct {
+	Type    string
+	Answers []string
+	Options []uint
+	Name    string
+}
+
+// Grading is the outcome of grading an answer
+type Grading struct {
+	Match string
+	// The answer as text, kept in the session report
+	Answer string
+	// The item the asked one was taken for, by id or by name, both empty when unknown
+	ConfusedWithID   uint
+	ConfusedWithName string
+}
+
+// QuestionGenerator builds one type of question and grades the answers to it
+type QuestionGenerator interface {
+	// Generate builds the question about the item.
+	// A question that would give the answer away by its ItemId has to leave it zero, the ticket then hides the item.
+	Generate(source QuestionSource, item *db.Item) (types.GameResponse, error)
+	// Grade grades the answer to the issued question, an error means the answer doesn't fit the question
+	Grade(tx *gorm.DB, exam *db.Exam, item *db.Item, question IssuedQuestion, answer *types.GetResult) (Grading, error)
+}
+
+var generators = map[string]QuestionGenerator{}
+
+// RegisterGenerator makes a question type available to exams, it is meant to be called from init
+func RegisterGenerator(questionType string, generator QuestionGenerator) {
+	generators[questionType] = generator
+}
+
+func Generator(questionType string) (QuestionGenerator, bool) {
+	generator, ok := generators[questionType]
+	return generator, ok
+}
+
+// QuestionTypes lists the registered question types in alphabetical order
+func QuestionTypes() []string {
+	questionTypes := make([]string, 0, len(generators))
+	for questionType := range generators {
+		questionTypes = append(questionTypes, questionType)
+	}
+	sort.Strings(questionTypes)
+
+	return questionTypes
+}
+
+// ListQuestionTypes tells exam authors which question types they can weight
+func (service *Service) ListQuestionTypes(c *gin.Context) {
+	c.JSON(http.StatusOK, QuestionTypes())
+}
+
+// questionTypeEnabled tells whether players may ask for the question type, exams without weights allow every type
+func questionTypeEnabled(weights map[string]int, questionType string) bool {
+	if _, ok := generators[questionType]; !ok {
+		return false
+	}
+
+	for _, weight := range weights {
+		if weight > 0 {
+			return weights[questionType] > 0
+		}
+	}
+
+	return true
+}
+
+// pickQuestionType picks a question type by the weights of the exam, multiple choice when it has none
+func pickQuestionType(random Random, weights map[string]int) string {
+	total := 0
+	for _, questionType := range QuestionTypes() {
+		total += max(weights[questionType], 0)
+	}
+
+	if total == 0 {
+		return types.QuestionChoice
+	}
+
+	// Going through the types in a fixed order keeps seeded questions reproducible
+	pick := random.Intn(total)
+	for _, questionType := range QuestionTypes() {
+		pick -= max(weights[questionType], 0)
+		if pick < 0 {
+			return questionType
+		}
+	}
+
+	return types.QuestionChoice
+}
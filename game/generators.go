@@ -0,0 +1,215 @@
+package game
+
+import (
+	"errors"
+	"recognizer/db"
+	"recognizer/types"
+
+	"gorm.io/gorm"
+)
+
+var errNotEnoughItems = errors.New("Not enough items for this question type")
+
+func init() {
+	RegisterGenerator(types.QuestionChoice, choiceGenerator{})
+	RegisterGenerator(types.QuestionTyped, typedGenerator{})
+	RegisterGenerator(types.QuestionReverse, reverseGenerator{})
+	RegisterGenerator(types.QuestionTrueFalse, trueFalseGenerator{})
+	RegisterGenerator(types.QuestionMatching, matchingGenerator{})
+}
+
+func offered(answers []string, answer string) bool {
+	for _, offered := range answers {
+		if offered == answer {
+			return true
+		}
+	}
+
+	return false
+}
+
+// choiceGenerator shows the image and offers names
+type choiceGenerator struct{}
+
+func (choiceGenerator) Generate(source QuestionSource, item *db.Item) (types.GameResponse, error) {
+	return NewQuestion(source, item), nil
+}
+
+func (choiceGenerator) Grade(tx *gorm.DB, exam *db.Exam, item *db.Item, question IssuedQuestion, answer *types.GetResult) (Grading, error) {
+	if !offered(question.Answers, answer.Answer) {
+		return Grading{}, errTicketMismatch
+	}
+
+	grading := Grading{Match: gradeAnswer(exam, item, types.QuestionChoice, answer.Answer, 0), Answer: answer.Answer}
+	if grading.Match == types.MatchWrong {
+		grading.ConfusedWithName = answer.Answer
+	}
+
+	return grading, nil
+}
+
+// typedGenerator shows the image and lets the player type the name
+type typedGenerator struct{}
+
+func (typedGenerator) Generate(source QuestionSource, item *db.Item) (types.GameResponse, error) {
+	return types.GameResponse{
+		Type:    types.QuestionTyped,
+		ItemId:  item.ID,
+		Image:   item.Image,
+		Answers: []string{},
+	}, nil
+}
+
+func (typedGenerator) Grade(tx *gorm.DB, exam *db.Exam, item *db.Item, question IssuedQuestion, answer *types.GetResult) (Grading, error) {
+	var otherNames []string
+	if err := tx.Model(&db.Item{}).Where("exam_id = ? AND id <> ?", exam.ID, item.ID).Pluck("name", &otherNames).Error; err != nil {
+		return Grading{}, err
+	}
+
+	grading := Grading{Match: gradeTyped(exam, item, answer.Answer, otherNames), Answer: answer.Answer}
+	if grading.Match == types.MatchWrong {
+		grading.ConfusedWithName = answer.Answer
+	}
+
+	return grading, nil
+}
+
+// reverseGenerator shows the name and offers images
+type reverseGenerator struct{}
+
+func (reverseGenerator) Generate(source QuestionSource, item *db.Item) (types.GameResponse, error) {
+	return newReverseQuestion(source, item), nil
+}
+
+func (reverseGenerator) Grade(tx *gorm.DB, exam *db.Exam, item *db.Item, question IssuedQuestion, answer *types.GetResult) (Grading, error) {
+	picked := false
+	for _, option := range question.Options {
+		if option == answer.AnswerItemId {
+			picked = true
+			break
+		}
+	}
+
+	if !picked {
+		return Grading{}, errTicketMismatch
+	}
+
+	// Graded by the picked item, its name is kept for the session report
+	var answerItem db.Item
+	tx.First(&answerItem, answer.AnswerItemId)
+
+	grading := Grading{Match: gradeAnswer(exam, item, types.QuestionReverse, "", answer.AnswerItemId), Answer: answerItem.Name}
+	if grading.Match == types.MatchWrong {
+		grading.ConfusedWithID = answer.AnswerItemId
+	}
+
+	return grading, nil
+}
+
+// trueFalseGenerator shows the image with a name, which is the right one half of the time
+type trueFalseGenerator struct{}
+
+func (trueFalseGenerator) Generate(source QuestionSource, item *db.Item) (types.GameResponse, error) {
+	name := item.Name
+	if source.random().Float64() < 0.5 {
+		if distractors := pickDistractors(source, item); len(distractors) > 0 {
+			name = distractors[0].Name
+		}
+	}
+
+	return types.GameResponse{
+		Type:    types.QuestionTrueFalse,
+		ItemId:  item.ID,
+		Image:   item.Image,
+		Name:    name,
+		Answers: []string{"true", "false"},
+	}, nil
+}
+
+func (trueFalseGenerator) Grade(tx *gorm.DB, exam *db.Exam, item *db.Item, question IssuedQuestion, answer *types.GetResult) (Grading, error) {
+	if !offered(question.Answers, answer.Answer) {
+		return Grading{}, errTicketMismatch
+	}
+
+	accepted := answer.Answer == "true"
+	grading := Grading{Match: types.MatchWrong, Answer: answer.Answer}
+	if accepted == (question.Name == item.Name) {
+		grading.Match = types.MatchExact
+	}
+
+	// Accepting a wrong name is taking the item for the other one
+	if accepted {
+		grading.Answer = question.Name
+		if grading.Match == types.MatchWrong {
+			grading.ConfusedWithName = question.Name
+		}
+	}
+
+	return grading, nil
+}
+
+// matchingGenerator shows several images and their names, each image has to be given its name
+type matchingGenerator struct{}
+
+func (matchingGenerator) Generate(source QuestionSource, item *db.Item) (types.GameResponse, error) {
+	pairs := append([]*db.Item{item}, pickDistractors(source, item)...)
+	if len(pairs) < 2 {
+		return types.GameResponse{}, errNotEnoughItems
+	}
+
+	source.random().Shuffle(len(pairs), func(i, j int) { pairs[i], pairs[j] = pairs[j], pairs[i] })
+
+	var options []types.GameOption
+	var names []string
+	for _, pair := range pairs {
+		options = append(options, types.GameOption{ItemId: pair.ID, Image: pair.Image})
+		names = append(names, pair.Name)
+	}
+
+	source.random().Shuffle(len(names), func(i, j int) { names[i], names[j] = names[j], names[i] })
+
+	return types.GameResponse{
+		Type:    types.QuestionMatching,
+		ItemId:  item.ID,
+		Answers: names,
+		Options: options,
+	}, nil
+}
+
+func (matchingGenerator) Grade(tx *gorm.DB, exam *db.Exam, item *db.Item, question IssuedQuestion, answer *types.GetResult) (Grading, error) {
+	if len(answer.Matches) != len(question.Options) {
+		return Grading{}, errTicketMismatch
+	}
+
+	var pairs []db.Item
+	if err := tx.Find(&pairs, question.Options).Error; err != nil {
+		return Grading{}, err
+	}
+
+	names := make(map[uint]string, len(pairs))
+	for _, pair := range pairs {
+		names[pair.ID] = pair.Name
+	}
+
+	grading := Grading{Match: types.MatchExact}
+	for i, option := range question.Options {
+		if !offered(question.Answers, answer.Matches[i]) {
+			return Grading{}, errTicketMismatch
+		}
+
+		if names[option] != answer.Matches[i] {
+			grading.Match = types.MatchWrong
+		}
+
+		// Only the asked item is recorded, the others were there to be told apart from it
+		if option == item.ID {
+			grading.Answer = answer.Matches[i]
+		}
+	}
+
+	if names[item.ID] != grading.Answer {
+		grading.ConfusedWithName = grading.Answer
+	}
+
+	return grading, nil
+}
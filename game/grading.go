@@ -0,0 +1,106 @@
+package game
+
+import (
+	"recognizer/db"
+	"recognizer/types"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// gradeAnswer grades the answer to a question of the given type about the item
+func gradeAnswer(exam *db.Exam, item *db.Item, questionType string, answer string, answerItemId uint) string {
+	switch questionType {
+	case types.QuestionTyped:
+		return gradeTyped(exam, item, answer, nil)
+	case types.QuestionReverse:
+		if answerItemId == item.ID {
+			return types.MatchExact
+		}
+	default:
+		if item.Name == answer {
+			return types.MatchExact
+		}
+	}
+
+	return types.MatchWrong
+}
+
+// gradeTyped compares a typed answer with the item name and its aliases using the tolerance of the exam.
+// An answer that is exactly the name of another item of the exam is wrong, however close it is to the item.
+func gradeTyped(exam *db.Exam, item *db.Item, answer string, otherNames []string) string {
+	answer = foldAnswer(exam, answer)
+	if answer == "" {
+		return types.MatchWrong
+	}
+
+	candidates := make([]string, 0, len(item.Aliases)+1)
+	for _, candidate := range append([]string{item.Name}, item.Aliases...) {
+		candidate = foldAnswer(exam, candidate)
+		if candidate == answer {
+			return types.MatchExact
+		}
+		candidates = append(candidates, candidate)
+	}
+
+	for _, name := range otherNames {
+		if foldAnswer(exam, name) == answer {
+			return types.MatchWrong
+		}
+	}
+
+	for _, candidate := range candidates {
+		if editDistance(candidate, answer) <= exam.MaxTypos {
+			return types.MatchNear
+		}
+	}
+
+	return types.MatchWrong
+}
+
+// foldAnswer normalizes whitespace and, unless the exam is strict about them, letter case and diacritics
+func foldAnswer(exam *db.Exam, answer string) string {
+	answer = strings.Join(strings.Fields(answer), " ")
+
+	if !exam.StrictCase {
+		answer = strings.ToLower(answer)
+	}
+
+	if !exam.StrictDiacritics {
+		var builder strings.Builder
+		for _, r := range norm.NFD.String(answer) {
+			if !unicode.Is(unicode.Mn, r) {
+				builder.WriteRune(r)
+			}
+		}
+		answer = norm.NFC.String(builder.String())
+	}
+
+	return answer
+}
+
+// editDistance is the Levenshtein distance of the two strings counted in runes
+func editDistance(a string, b string) int {
+	ra, rb := []rune(a), []rune(b)
+
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+
+	return previous[len(rb)]
+}
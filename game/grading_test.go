@@ -0,0 +1,94 @@
+package game
+
+import (
+	"recognizer/db"
+	"recognizer/types"
+	"testing"
+)
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		distance int
+	}{
+		{"", "", 0},
+		{"pine", "", 4},
+		{"", "pine", 4},
+		{"pine", "pine", 0},
+		{"pine", "pike", 1},
+		{"pine", "spine", 1},
+		{"pine", "pin", 1},
+		{"kitten", "sitting", 3},
+		{"flaw", "lawn", 2},
+		{"žluva", "zluva", 1},
+		{"smrk", "smrč", 1},
+	}
+
+	for _, test := range tests {
+		if got := editDistance(test.a, test.b); got != test.distance {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", test.a, test.b, got, test.distance)
+		}
+		if got := editDistance(test.b, test.a); got != test.distance {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", test.b, test.a, got, test.distance)
+		}
+	}
+}
+
+func TestFoldAnswer(t *testing.T) {
+	tests := []struct {
+		name   string
+		exam   db.Exam
+		answer string
+		folded string
+	}{
+		{"lower case", db.Exam{}, "Scots Pine", "scots pine"},
+		{"whitespace", db.Exam{}, "  scots \t pine \n", "scots pine"},
+		{"diacritics", db.Exam{}, "Žluťoučký kůň", "zlutoucky kun"},
+		{"decomposed diacritics", db.Exam{}, "Z\u030cluva", "zluva"},
+		{"strict case", db.Exam{StrictCase: true}, "Scots Pine", "Scots Pine"},
+		{"strict diacritics", db.Exam{StrictDiacritics: true}, "Žluva", "žluva"},
+		{"strict diacritics keep the form", db.Exam{StrictDiacritics: true}, "z\u030cluva", "z\u030cluva"},
+		{"strict both", db.Exam{StrictCase: true, StrictDiacritics: true}, " Žluva  obecná ", "Žluva obecná"},
+		{"empty", db.Exam{}, "   ", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := foldAnswer(&test.exam, test.answer); got != test.folded {
+				t.Errorf("got %q, want %q", got, test.folded)
+			}
+		})
+	}
+}
+
+func TestGradeTyped(t *testing.T) {
+	exam := &db.Exam{MaxTypos: 1}
+	pine := &db.Item{Name: "Pine", Aliases: []string{"Scots pine"}}
+
+	tests := []struct {
+		name       string
+		answer     string
+		otherNames []string
+		match      string
+	}{
+		{"exact", "pine", nil, types.MatchExact},
+		{"alias", "scots  PINE", nil, types.MatchExact},
+		{"typo", "pime", nil, types.MatchNear},
+		{"typo in alias", "scot pine", nil, types.MatchNear},
+		{"too many typos", "pike tree", nil, types.MatchWrong},
+		{"empty", "  ", nil, types.MatchWrong},
+		{"name of another item", "Pike", []string{"Spruce", "Pike"}, types.MatchWrong},
+		{"another item folded", "PÍKE", []string{"Pike"}, types.MatchWrong},
+		{"typo of another item", "Pikes", []string{"Pike"}, types.MatchWrong},
+		{"near with other names", "pime", []string{"Pike"}, types.MatchNear},
+		{"other item named the same", "pine", []string{"Pine"}, types.MatchExact},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := gradeTyped(exam, pine, test.answer, test.otherNames); got != test.match {
+				t.Errorf("got %q, want %q", got, test.match)
+			}
+		})
+	}
+}
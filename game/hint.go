@@ -0,0 +1,154 @@
+package game
+
+import (
+	"errors"
+	"hash/fnv"
+	"net/http"
+	"recognizer/db"
+	"recognizer/types"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Wrong options removed by the fifty-fifty hint, at least one is always left
+const fiftyFiftyRemoved = 2
+
+var errHintUnavailable = errors.New("This hint is not available for this question")
+
+// GetHint gives a hint for a served question, asking for the same hint again gives the same one
+func (service *Service) GetHint(c *gin.Context) {
+	var data types.GetHint
+
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userId := c.MustGet("userId").(uint)
+
+	claims, err := parseTicket(data.Ticket)
+	if err == nil && claims.UserID != userId {
+		err = errTicketMismatch
+	}
+	if err == nil {
+		var usedTicket db.UsedTicket
+		if service.DB.Where("ticket_id = ?", claims.Id).First(&usedTicket).Error == nil {
+			err = errTicketUsed
+		}
+	}
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	itemId, err := claims.questionItem()
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	var item *db.Item
+	res := service.DB.First(&item, itemId)
+
+	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		return
+	}
+
+	if _, err := service.findExam(c, item.ExamID); err != nil {
+		return
+	}
+
+	hint := types.HintResponse{Kind: data.Kind}
+	switch data.Kind {
+	case types.HintGroup:
+		var group db.Group
+		service.DB.First(&group, item.GroupID)
+		hint.Group = group.Name
+	case types.HintFiftyFifty:
+		err = fiftyFifty(claims, item, &hint)
+	case types.HintLetters:
+		// The name is already shown in reverse questions
+		if claims.Type == types.QuestionReverse {
+			err = errHintUnavailable
+		}
+		hint.Letters = firstLetters(item.Name)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = service.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&db.UsedHint{
+		TicketID: claims.Id,
+		Kind:     data.Kind,
+		UserID:   userId,
+	}).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error recording hint"})
+		return
+	}
+
+	var used int64
+	service.DB.Model(&db.UsedHint{}).Where("ticket_id = ?", claims.Id).Count(&used)
+	hint.Used = int(used)
+
+	c.JSON(http.StatusOK, hint)
+}
+
+// fiftyFifty removes wrong options of a choice or reverse question.
+// The options are drawn with a generator seeded from the ticket, so asking again removes the same ones.
+func fiftyFifty(claims *ticketClaims, item *db.Item, hint *types.HintResponse) error {
+	hash := fnv.New64a()
+	hash.Write([]byte(claims.Id))
+	random := seededRandom(int64(hash.Sum64()))
+
+	switch claims.Type {
+	case types.QuestionChoice:
+		var wrong []string
+		for _, answer := range claims.Answers {
+			if answer != item.Name {
+				wrong = append(wrong, answer)
+			}
+		}
+
+		if len(wrong) < 2 {
+			return errHintUnavailable
+		}
+
+		random.Shuffle(len(wrong), func(i, j int) { wrong[i], wrong[j] = wrong[j], wrong[i] })
+		hint.Removed = wrong[:min(fiftyFiftyRemoved, len(wrong)-1)]
+	case types.QuestionReverse:
+		var wrong []uint
+		for _, option := range claims.Options {
+			if option != item.ID {
+				wrong = append(wrong, option)
+			}
+		}
+
+		if len(wrong) < 2 {
+			return errHintUnavailable
+		}
+
+		random.Shuffle(len(wrong), func(i, j int) { wrong[i], wrong[j] = wrong[j], wrong[i] })
+		hint.RemovedItemIds = wrong[:min(fiftyFiftyRemoved, len(wrong)-1)]
+	default:
+		return errHintUnavailable
+	}
+
+	return nil
+}
+
+// firstLetters keeps the first letter of each word of the name and hides the others
+func firstLetters(name string) string {
+	words := strings.Fields(name)
+	for i, word := range words {
+		letters := []rune(word)
+		words[i] = string(letters[0]) + strings.Repeat("_", len(letters)-1)
+	}
+
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,65 @@
+package game
+
+import (
+	"recognizer/db"
+	"recognizer/types"
+
+	"gorm.io/gorm"
+)
+
+// pickImage picks one of the images of the item at random, nil when the item only has its single image
+func pickImage(tx *gorm.DB, random Random, item *db.Item) (*db.ItemImage, error) {
+	var images []db.ItemImage
+	err := tx.Where("item_id = ?", item.ID).Order("position").Find(&images).Error
+	if err != nil || len(images) == 0 {
+		return nil, err
+	}
+
+	return &images[random.Intn(len(images))], nil
+}
+
+// DescribeMedia tells the client how to play the media of the question and of its options
+func DescribeMedia(tx *gorm.DB, question *types.GameResponse) error {
+	var keys []string
+	if question.Image != "" {
+		keys = append(keys, question.Image)
+	}
+	for _, option := range question.Options {
+		keys = append(keys, option.Image)
+	}
+
+	if len(keys) == 0 {
+		return nil
+	}
+
+	var mediaFiles []db.MediaFile
+	if err := tx.Where("key IN ?", keys).Find(&mediaFiles).Error; err != nil {
+		return err
+	}
+
+	media := make(map[string]*types.GameMedia, len(mediaFiles))
+	for _, mediaFile := range mediaFiles {
+		media[mediaFile.Key] = &types.GameMedia{
+			Type:        mediaFile.MediaType,
+			ContentType: mediaFile.ContentType,
+			DurationMs:  mediaFile.DurationMs,
+		}
+	}
+
+	// Files uploaded before other kinds of media were known are images
+	describe := func(key string) *types.GameMedia {
+		if found, ok := media[key]; ok {
+			return found
+		}
+		return &types.GameMedia{Type: types.MediaImage}
+	}
+
+	if question.Image != "" {
+		question.Media = describe(question.Image)
+	}
+	for i := range question.Options {
+		question.Options[i].Media = describe(question.Options[i].Image)
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package game
+
+import (
+	"net/http"
+	"recognizer/db"
+	"recognizer/types"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Only wrong answers from this recent past make up the mistake set
+const mistakeWindow = 30 * 24 * time.Hour
+
+func (service *Service) ListMistakes(c *gin.Context) {
+	examIdParam, err := strconv.ParseUint(c.Param("examId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := service.findExam(c, uint(examIdParam)); err != nil {
+		return
+	}
+
+	mistakes, err := service.loadMistakes(c.MustGet("userId").(uint), uint(examIdParam), time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading mistakes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, mistakes)
+}
+
+// loadMistakes returns the items of the exam the user recently got wrong and hasn't answered correctly since
+func (service *Service) loadMistakes(userId uint, examId uint, now time.Time) ([]types.MistakeItem, error) {
+	lastCorrect := service.DB.Model(&db.ScorePoint{}).
+		Select("item_id, MAX(created_at) as last_correct_at").
+		Where("user_id = ? AND exam_id = ? AND correct", userId, examId).
+		Group("item_id")
+
+	mistakes := []types.MistakeItem{}
+	err := service.DB.Model(&db.ScorePoint{}).
+		Select("score_points.item_id, items.name, items.image, items.group_id, "+
+			"CAST(COUNT(*) AS INT) as wrong_count, "+
+			"MAX(score_points.created_at) as last_seen_at").
+		Joins("INNER JOIN items ON items.id = score_points.item_id AND items.deleted_at IS NULL").
+		Joins("LEFT JOIN (?) AS last_correct ON last_correct.item_id = score_points.item_id", lastCorrect).
+		Where("score_points.user_id = ? AND score_points.exam_id = ?", userId, examId).
+		Where("NOT score_points.correct AND score_points.created_at > ?", now.Add(-mistakeWindow)).
+		Where("(last_correct.last_correct_at IS NULL OR score_points.created_at > last_correct.last_correct_at)").
+		Group("score_points.item_id, items.name, items.image, items.group_id").
+		Order("last_seen_at DESC").
+		Scan(&mistakes).Error
+
+	return mistakes, err
+}
+
+// pickMistake picks a random item of the mistake set out of the given items, nil when there is none
+func (service *Service) pickMistake(userId uint, examId uint, items []*db.Item) (*db.Item, error) {
+	mistakes, err := service.loadMistakes(userId, examId, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	isMistake := make(map[uint]bool, len(mistakes))
+	for _, mistake := range mistakes {
+		isMistake[mistake.ItemId] = true
+	}
+
+	var pool []*db.Item
+	for _, item := range items {
+		if isMistake[item.ID] {
+			pool = append(pool, item)
+		}
+	}
+
+	if len(pool) == 0 {
+		return nil, nil
+	}
+
+	return pool[service.Random.Intn(len(pool))], nil
+}
@@ -0,0 +1,361 @@
+package game
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"recognizer/db"
+	"recognizer/review"
+	"recognizer/scoring"
+	"recognizer/types"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// Results of an offline pack can be synced for this long after it was downloaded
+	packLifetime = 30 * 24 * time.Hour
+	// Most results one pack can sync, a new pack has to be downloaded for more
+	maxPackResults = 1000
+	// Client clocks may be off by this much from the server
+	packClockSkew = 5 * time.Minute
+)
+
+var errPackExpired = errors.New("Offline pack has expired, download a new one")
+
+// packClaims bind an offline pack to the user who downloaded it
+type packClaims struct {
+	UserID  uint   `json:"userId"`
+	ExamID  uint   `json:"examId"`
+	Version string `json:"version"`
+	jwt.StandardClaims
+}
+
+// GetOfflinePack exports the exam for practice without connectivity
+func (service *Service) GetOfflinePack(c *gin.Context) {
+	examIdParam, err := strconv.ParseUint(c.Param("examId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	foundExam, err := service.findExam(c, uint(examIdParam))
+	if err != nil {
+		return
+	}
+
+	var groups []db.Group
+	service.DB.Where("exam_id = ?", foundExam.ID).Order("id").Find(&groups)
+
+	var items []db.Item
+	service.DB.Preload("Images", func(tx *gorm.DB) *gorm.DB { return tx.Order("position") }).
+		Where("exam_id = ?", foundExam.ID).Order("id").Find(&items)
+
+	pack := types.OfflinePack{
+		Format:            types.OfflinePackFormat,
+		ExamId:            foundExam.ID,
+		Name:              foundExam.Name,
+		MaxTypos:          foundExam.MaxTypos,
+		StrictCase:        foundExam.StrictCase,
+		StrictDiacritics:  foundExam.StrictDiacritics,
+		QuestionTimeLimit: foundExam.QuestionTimeLimit,
+		AnswerCount:       foundExam.AnswerCount,
+		QuestionTypes:     foundExam.QuestionTypes,
+		Groups:            []types.PackGroup{},
+		Items:             []types.PackItem{},
+	}
+	for _, group := range groups {
+		pack.Groups = append(pack.Groups, types.PackGroup{Id: group.ID, Name: group.Name})
+	}
+	for _, item := range items {
+		packItem := types.PackItem{
+			Id:        item.ID,
+			Name:      item.Name,
+			Image:     item.Image,
+			Aliases:   item.Aliases,
+			GroupId:   item.GroupID,
+			Images:    []string{},
+			MediaType: item.MediaType,
+		}
+		for _, image := range item.Images {
+			packItem.Images = append(packItem.Images, image.Image)
+		}
+		pack.Items = append(pack.Items, packItem)
+	}
+
+	version, err := packVersion(pack)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error building offline pack"})
+		return
+	}
+
+	now := time.Now()
+	pack.Version = version
+	pack.GeneratedAt = now
+
+	pack.Token, err = jwt.NewWithClaims(jwt.SigningMethodHS256, packClaims{
+		UserID:  c.MustGet("userId").(uint),
+		ExamID:  foundExam.ID,
+		Version: version,
+		StandardClaims: jwt.StandardClaims{
+			Id:        uuid.New().String(),
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(packLifetime).Unix(),
+		},
+	}).SignedString(ticketSecret())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error signing offline pack"})
+		return
+	}
+
+	c.JSON(http.StatusOK, pack)
+}
+
+// packVersion hashes the content of the pack, so clients can tell whether their copy is outdated
+func packVersion(pack types.OfflinePack) (string, error) {
+	content, err := json.Marshal(pack)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.Sum256(content)
+	return hex.EncodeToString(hash[:8]), nil
+}
+
+func parsePackToken(token string) (*packClaims, error) {
+	claims := &packClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return ticketSecret(), nil
+	})
+
+	var validationErr *jwt.ValidationError
+	if errors.As(err, &validationErr) && validationErr.Errors&jwt.ValidationErrorExpired != 0 {
+		return nil, errPackExpired
+	}
+
+	if err != nil || claims.ExamID == 0 || claims.Id == "" {
+		return nil, errors.New("Invalid offline pack")
+	}
+
+	return claims, nil
+}
+
+// SyncResults stores the answers recorded offline with a pack.
+// Results already synced before are reported as duplicates, so a failed sync can simply be sent again.
+// A pack syncs a limited number of results, each answered after the results synced with it before and while the pack was valid.
+func (service *Service) SyncResults(c *gin.Context) {
+	var data types.SyncResults
+
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userId := c.MustGet("userId").(uint)
+
+	claims, err := parsePackToken(data.Token)
+	if err == nil && claims.UserID != userId {
+		err = errors.New("Offline pack belongs to another user")
+	}
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	foundExam, err := service.findExam(c, claims.ExamID)
+	if err != nil {
+		return
+	}
+
+	var items []*db.Item
+	service.DB.Where("exam_id = ?", foundExam.ID).Find(&items)
+
+	itemsById := make(map[uint]*db.Item, len(items))
+	for _, item := range items {
+		item.Exam = *foundExam
+		itemsById[item.ID] = item
+	}
+
+	// Review schedules and ratings have to see the answers in the order they were given
+	results := make([]types.OfflineResult, len(data.Results))
+	copy(results, data.Results)
+	sort.SliceStable(results, func(i, j int) bool { return results[i].AnsweredAt.Before(results[j].AnsweredAt) })
+
+	keys := make([]string, 0, len(results))
+	for _, result := range results {
+		keys = append(keys, result.IdempotencyKey)
+	}
+
+	var syncedKeys []string
+	service.DB.Model(&db.ScorePoint{}).Where("user_id = ? AND idempotency_key IN ?", userId, keys).Pluck("idempotency_key", &syncedKeys)
+
+	synced := make(map[string]bool, len(syncedKeys))
+	for _, key := range syncedKeys {
+		synced[key] = true
+	}
+
+	var packStats struct {
+		Results    int64
+		AnsweredAt *time.Time
+	}
+	err = service.DB.Model(&db.ScorePoint{}).
+		Select("COUNT(id) as results, MAX(answered_at) as answered_at").
+		Where("pack_id = ?", claims.Id).
+		Scan(&packStats).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading synced results"})
+		return
+	}
+
+	packIssuedAt := time.Unix(claims.IssuedAt, 0)
+	packExpiresAt := time.Unix(claims.ExpiresAt, 0)
+	now := time.Now()
+
+	// Answers of one pack can't overlap, each one starts after the one before was answered
+	var lastAnsweredAt time.Time
+	if packStats.AnsweredAt != nil {
+		lastAnsweredAt = *packStats.AnsweredAt
+	}
+
+	statuses := make([]types.SyncResultStatus, 0, len(results))
+	for _, result := range results {
+		status := types.SyncResultStatus{IdempotencyKey: result.IdempotencyKey}
+
+		if synced[result.IdempotencyKey] {
+			status.Status = types.SyncDuplicate
+			statuses = append(statuses, status)
+			continue
+		}
+
+		item, ok := itemsById[result.ItemId]
+		if !ok {
+			status.Status = types.SyncRejected
+			status.Error = "Item is not part of this exam"
+			statuses = append(statuses, status)
+			continue
+		}
+
+		// Only items of the exam can be picked in a reverse question
+		if _, ok := itemsById[result.AnswerItemId]; !ok {
+			result.AnswerItemId = 0
+		}
+
+		// Client clocks are trusted within a small skew, answers outside the lifetime of the pack weren't given with it
+		answeredAt := result.AnsweredAt
+		if answeredAt.Before(packIssuedAt.Add(-packClockSkew)) || answeredAt.After(now.Add(packClockSkew)) || answeredAt.After(packExpiresAt.Add(packClockSkew)) {
+			status.Status = types.SyncRejected
+			status.Error = "Result wasn't answered while the pack was valid"
+			statuses = append(statuses, status)
+			continue
+		}
+		if answeredAt.Before(packIssuedAt) {
+			answeredAt = packIssuedAt
+		}
+		if answeredAt.After(now) {
+			answeredAt = now
+		}
+		servedAt := answeredAt.Add(-time.Duration(result.ResponseMs) * time.Millisecond)
+
+		if servedAt.Before(lastAnsweredAt) {
+			status.Status = types.SyncRejected
+			status.Error = "Result overlaps with another result of the pack"
+			statuses = append(statuses, status)
+			continue
+		}
+
+		if packStats.Results >= maxPackResults {
+			status.Status = types.SyncRejected
+			status.Error = "Offline pack has no results left, download a new one"
+			statuses = append(statuses, status)
+			continue
+		}
+
+		// Offline questions are built by the client, the answer is graded as if it had been offered
+		generator, ok := Generator(result.Type)
+		if !ok || !questionTypeEnabled(foundExam.QuestionTypes, result.Type) {
+			status.Status = types.SyncRejected
+			status.Error = "Question type isn't enabled for this exam"
+			statuses = append(statuses, status)
+			continue
+		}
+
+		question := IssuedQuestion{Type: result.Type, Answers: []string{result.Answer}, Options: []uint{result.AnswerItemId}}
+		grading, err := generator.Grade(service.DB, foundExam, item, question, &types.GetResult{Answer: result.Answer, AnswerItemId: result.AnswerItemId})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error grading results"})
+			return
+		}
+
+		match := grading.Match
+		timedOut := foundExam.QuestionTimeLimit > 0 && result.ResponseMs > int64(foundExam.QuestionTimeLimit)*1000+timeLimitGraceMs
+		if timedOut {
+			match = types.MatchWrong
+		}
+		status.Correct = match != types.MatchWrong
+
+		points, err := scoring.Score(service.DB, foundExam, userId, scoring.Answer{Correct: status.Correct, ResponseMs: result.ResponseMs}, answeredAt)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error scoring results"})
+			return
+		}
+
+		scorePoint := db.ScorePoint{
+			BaseModel:      db.BaseModel{CreatedAt: answeredAt},
+			UserID:         userId,
+			ExamID:         foundExam.ID,
+			ItemID:         item.ID,
+			Correct:        status.Correct,
+			IdempotencyKey: &result.IdempotencyKey,
+			PackID:         &claims.Id,
+			ServedAt:       &servedAt,
+			AnsweredAt:     &answeredAt,
+			ResponseMs:     result.ResponseMs,
+			TimedOut:       timedOut,
+			Points:         points,
+			ScoringVersion: foundExam.ScoringVersion,
+		}
+
+		res := service.DB.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}, {Name: "idempotency_key"}},
+			DoNothing: true,
+		}).Create(&scorePoint)
+		if res.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error storing results"})
+			return
+		}
+
+		if res.RowsAffected == 0 {
+			status.Status = types.SyncDuplicate
+			statuses = append(statuses, status)
+			continue
+		}
+
+		packStats.Results++
+		lastAnsweredAt = answeredAt
+
+		// The client graded the question it built, so only the own review schedule of the user follows the answer.
+		// Ratings and confusions are shared with everyone playing the exam and stay with online answers.
+		if err := review.Record(service.DB, userId, item, status.Correct, answeredAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error storing results"})
+			return
+		}
+
+		status.Status = types.SyncCreated
+		statuses = append(statuses, status)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"version": claims.Version, "results": statuses})
+}
@@ -0,0 +1,205 @@
+package game
+
+import (
+	"fmt"
+	"recognizer/db"
+	"recognizer/types"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// Used when the exam has no valid answer count
+	defaultAnswerCount = 4
+	// Number of items loaded from other exams when an exam runs out of distractors
+	sharedPoolSize = 50
+)
+
+// QuestionSource holds everything questions about items of one exam are built from
+type QuestionSource struct {
+	Exam       *db.Exam
+	Items      []*db.Item
+	Confusions map[uint]int
+	// Only called when the exam itself has too few distractors, can be nil
+	SharedPool func() []*db.Item
+	// Nil uses the global source
+	Random Random
+}
+
+func (source QuestionSource) random() Random {
+	if source.Random == nil {
+		return globalRandom{}
+	}
+
+	return source.Random
+}
+
+// NewQuestionSource loads the confusions of the item and prepares the shared pool of the exam
+func NewQuestionSource(tx *gorm.DB, exam *db.Exam, items []*db.Item, item *db.Item) (QuestionSource, error) {
+	confusions, err := LoadConfusions(tx, item.ID)
+	if err != nil {
+		return QuestionSource{}, err
+	}
+
+	return QuestionSource{
+		Exam:       exam,
+		Items:      items,
+		Confusions: confusions,
+		SharedPool: func() []*db.Item {
+			pool, err := LoadSharedPool(tx, exam)
+			if err != nil {
+				fmt.Println(err.Error())
+			}
+			return pool
+		},
+	}, nil
+}
+
+// LoadSharedPool returns random items from the other public exams of the owner of the exam.
+// Everyone playing the exam sees the distractors, so items of exams they may not see stay out.
+func LoadSharedPool(tx *gorm.DB, exam *db.Exam) ([]*db.Item, error) {
+	publicExams := tx.Model(&db.Exam{}).Select("id").Where("user_id = ? AND visibility = ?", exam.UserID, types.VisibilityPublic)
+
+	var items []*db.Item
+	err := tx.
+		Where("exam_id <> ? AND exam_id IN (?)", exam.ID, publicExams).
+		Order("RANDOM()").
+		Limit(sharedPoolSize).
+		Find(&items).Error
+
+	return items, err
+}
+
+// NewQuestion builds the multiple choice question for the item, see pickDistractors for where the other answers come from
+func NewQuestion(source QuestionSource, randomItem *db.Item) types.GameResponse {
+	var answersItems []string
+	for _, item := range pickDistractors(source, randomItem) {
+		answersItems = append(answersItems, item.Name)
+	}
+	answersItems = append(answersItems, randomItem.Name)
+
+	// Shuffle the answers
+	source.random().Shuffle(len(answersItems), func(i, j int) { answersItems[i], answersItems[j] = answersItems[j], answersItems[i] })
+
+	return types.GameResponse{
+		Type:    types.QuestionChoice,
+		ItemId:  randomItem.ID,
+		Image:   randomItem.Image,
+		Answers: answersItems,
+	}
+}
+
+// newReverseQuestion shows the name of the item and offers images of the distractors
+func newReverseQuestion(source QuestionSource, randomItem *db.Item) types.GameResponse {
+	options := []types.GameOption{{ItemId: randomItem.ID, Image: randomItem.Image}}
+	for _, item := range pickDistractors(source, randomItem) {
+		options = append(options, types.GameOption{ItemId: item.ID, Image: item.Image})
+	}
+
+	source.random().Shuffle(len(options), func(i, j int) { options[i], options[j] = options[j], options[i] })
+
+	return types.GameResponse{
+		Type:    types.QuestionReverse,
+		Name:    randomItem.Name,
+		Answers: []string{},
+		Options: options,
+	}
+}
+
+// pickDistractors chooses the wrong answers for the item, one less than the answer count of the exam.
+// The group of the item and the items most confused with it come first, then the other groups of the exam
+// and then the shared pool. Items named like the correct answer or like another distractor are skipped.
+func pickDistractors(source QuestionSource, randomItem *db.Item) []*db.Item {
+	answerCount := source.Exam.AnswerCount
+	if answerCount < 2 {
+		answerCount = defaultAnswerCount
+	}
+	picker := newDistractorPicker(source.Exam, randomItem, answerCount-1)
+
+	var siblings, confused, others []*db.Item
+	for _, item := range source.Items {
+		if item.ID == randomItem.ID {
+			continue
+		}
+
+		if item.GroupID == randomItem.GroupID {
+			siblings = append(siblings, item)
+		} else {
+			others = append(others, item)
+		}
+
+		if source.Confusions[item.ID] > 0 {
+			confused = append(confused, item)
+		}
+	}
+
+	shuffleItems(source.random(), siblings)
+	pickConfused(picker, source.random(), siblings, confused, source.Confusions)
+
+	shuffleItems(source.random(), others)
+	picker.takeAll(others)
+
+	if !picker.full() && source.SharedPool != nil {
+		picker.takeAll(source.SharedPool())
+	}
+
+	return picker.picked
+}
+
+func shuffleItems(random Random, items []*db.Item) {
+	random.Shuffle(len(items), func(i, j int) { items[i], items[j] = items[j], items[i] })
+}
+
+// distractorPicker collects distractors with distinct names that differ from the correct answer.
+// Only items with the same kind of media are taken, a sound among images would give itself away.
+type distractorPicker struct {
+	exam      *db.Exam
+	count     int
+	mediaType string
+	picked    []*db.Item
+	names     map[string]bool
+}
+
+func newDistractorPicker(exam *db.Exam, randomItem *db.Item, count int) *distractorPicker {
+	return &distractorPicker{
+		exam:      exam,
+		count:     count,
+		mediaType: randomItem.MediaType,
+		names:     map[string]bool{foldAnswer(exam, randomItem.Name): true},
+	}
+}
+
+func (picker *distractorPicker) full() bool {
+	return len(picker.picked) >= picker.count
+}
+
+func (picker *distractorPicker) take(item *db.Item) bool {
+	name := foldAnswer(picker.exam, item.Name)
+	if picker.full() || picker.names[name] || item.MediaType != picker.mediaType {
+		return false
+	}
+
+	picker.names[name] = true
+	picker.picked = append(picker.picked, item)
+	return true
+}
+
+// takeFirst takes the first item of the pool that can still be used
+func (picker *distractorPicker) takeFirst(pool []*db.Item) bool {
+	for _, item := range pool {
+		if picker.take(item) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (picker *distractorPicker) takeAll(pool []*db.Item) {
+	for _, item := range pool {
+		if picker.full() {
+			return
+		}
+		picker.take(item)
+	}
+}
@@ -0,0 +1,30 @@
+package game
+
+import "math/rand"
+
+// Random is the source of randomness of the game, a seeded *rand.Rand reproduces the same questions
+type Random interface {
+	Intn(n int) int
+	Float64() float64
+	Shuffle(n int, swap func(i, j int))
+}
+
+// globalRandom uses the global source of math/rand, which is safe for concurrent use
+type globalRandom struct{}
+
+func (globalRandom) Intn(n int) int {
+	return rand.Intn(n)
+}
+
+func (globalRandom) Float64() float64 {
+	return rand.Float64()
+}
+
+func (globalRandom) Shuffle(n int, swap func(i, j int)) {
+	rand.Shuffle(n, swap)
+}
+
+// seededRandom always gives the same sequence for the same seed, it must not be shared between goroutines
+func seededRandom(seed int64) Random {
+	return rand.New(rand.NewSource(seed))
+}
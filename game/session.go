@@ -0,0 +1,283 @@
+package game
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"recognizer/db"
+	"recognizer/types"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var (
+	errSessionNotFound    = errors.New("Session not found")
+	errSessionFinished    = errors.New("Session is already finished")
+	errNotCurrentQuestion = errors.New("This item is not the current question of the session")
+)
+
+func (service *Service) CreateSession(c *gin.Context) {
+	var data types.CreateGameSession
+
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := service.findExam(c, data.ExamId); err != nil {
+		return
+	}
+
+	query := service.DB.Where("exam_id = ?", data.ExamId)
+	if data.GroupId != nil {
+		var foundGroup *db.Group
+		res := service.DB.Where("exam_id = ?", data.ExamId).First(&foundGroup, *data.GroupId)
+
+		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+			return
+		}
+
+		query = query.Where("group_id = ?", *data.GroupId)
+	}
+
+	var items []*db.Item
+	query.Find(&items)
+
+	if len(items) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No items in this exam"})
+		return
+	}
+
+	// Questions never repeat, so a session can't be longer than the number of items
+	shuffleItems(service.Random, items)
+	count := data.Count
+	if count > len(items) {
+		count = len(items)
+	}
+
+	itemIds := make([]uint, 0, count)
+	for _, item := range items[:count] {
+		itemIds = append(itemIds, item.ID)
+	}
+
+	session := db.GameSession{
+		UserID:  c.MustGet("userId").(uint),
+		ExamID:  data.ExamId,
+		GroupID: data.GroupId,
+	}
+
+	if err := service.startSession(&session, itemIds); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, newSessionReport(&session, time.Now()))
+}
+
+// startSession stores the session with its questions in the given order
+func (service *Service) startSession(session *db.GameSession, itemIds []uint) error {
+	for position, itemId := range itemIds {
+		session.Questions = append(session.Questions, db.GameSessionQuestion{
+			ItemID:   itemId,
+			Position: position,
+		})
+	}
+
+	return service.DB.Omit("Questions.Item").Create(session).Error
+}
+
+func (service *Service) GetSessionQuestion(c *gin.Context) {
+	session, err := service.loadSession(c)
+	if err != nil {
+		return
+	}
+
+	// Every question can be answered before the session is marked finished
+	question := currentQuestion(session)
+	if session.FinishedAt != nil || question == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errSessionFinished.Error()})
+		return
+	}
+
+	foundExam, err := service.findExam(c, session.ExamID)
+	if err != nil {
+		return
+	}
+
+	// A session of a single group practices just that group
+	var filter *db.PracticeFilter
+	if session.GroupID != nil {
+		filter = &db.PracticeFilter{GroupIDs: []uint{*session.GroupID}}
+	}
+
+	var items []*db.Item
+	applyFilter(service.DB.Where("exam_id = ?", session.ExamID), filter).Order("id").Find(&items)
+
+	source, err := service.questionSource(foundExam, items, &question.Item, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading confusions"})
+		return
+	}
+
+	// Everyone playing a daily challenge gets the same answers to pick from
+	if session.ChallengeID != nil {
+		var challenge db.DailyChallenge
+		service.DB.First(&challenge, *session.ChallengeID)
+
+		source.Random = seededRandom(challenge.Seed + int64(question.Position))
+		source.Confusions = nil
+		source.SharedPool = nil
+	}
+
+	// Players of a session can't pick the question types, the weights of the exam decide
+	service.respondWithQuestion(c, source, &question.Item, filter, "")
+}
+
+func (service *Service) GetSession(c *gin.Context) {
+	session, err := service.loadSession(c)
+	if err != nil {
+		return
+	}
+
+	report := newSessionReport(session, time.Now())
+	err = service.DB.Model(&db.ScorePoint{}).
+		Select("COALESCE(SUM(points), 0)").
+		Where("session_id = ? AND user_id = ?", session.ID, session.UserID).
+		Scan(&report.Points).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading points"})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// loadSession loads the session from the URL with its questions and writes the error response when it can't
+func (service *Service) loadSession(c *gin.Context) (*db.GameSession, error) {
+	sessionIdParam, err := strconv.ParseUint(c.Param("sessionId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, err
+	}
+
+	session, err := service.findSession(uint(sessionIdParam), c.MustGet("userId").(uint))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return nil, err
+	}
+
+	return session, nil
+}
+
+func (service *Service) findSession(sessionId uint, userId uint) (*db.GameSession, error) {
+	var session *db.GameSession
+	res := service.DB.
+		Preload("Questions", func(tx *gorm.DB) *gorm.DB { return tx.Order("position") }).
+		Preload("Questions.Item").
+		Where("user_id = ?", userId).
+		First(&session, sessionId)
+
+	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		return nil, errSessionNotFound
+	}
+
+	return session, res.Error
+}
+
+// answerSessionQuestion stores the answer to the current question of the session and finishes the session after the last one
+func (service *Service) answerSessionQuestion(sessionId uint, userId uint, itemId uint, answer string, correct bool) error {
+	session, err := service.findSession(sessionId, userId)
+	if err != nil {
+		return err
+	}
+
+	question := currentQuestion(session)
+	if session.FinishedAt != nil || question == nil {
+		return errSessionFinished
+	}
+
+	if question.ItemID != itemId {
+		return errNotCurrentQuestion
+	}
+
+	// The last answer and the end of the session are stored together
+	now := time.Now()
+	return service.DB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&db.GameSessionQuestion{}).
+			Where("id = ? AND answered = ?", question.ID, false).
+			Updates(map[string]interface{}{"answered": true, "answer": answer, "correct": correct, "answered_at": now})
+
+		if res.Error != nil {
+			return res.Error
+		}
+
+		// Someone else answered this question in the meantime
+		if res.RowsAffected == 0 {
+			return errNotCurrentQuestion
+		}
+
+		if question.Position == len(session.Questions)-1 {
+			return tx.Model(&session).Update("finished_at", now).Error
+		}
+
+		return nil
+	})
+}
+
+// currentQuestion returns the first question of an unfinished session that has no answer yet
+func currentQuestion(session *db.GameSession) *db.GameSessionQuestion {
+	for i := range session.Questions {
+		if !session.Questions[i].Answered {
+			return &session.Questions[i]
+		}
+	}
+
+	return nil
+}
+
+func newSessionReport(session *db.GameSession, now time.Time) types.GameSessionReport {
+	report := types.GameSessionReport{
+		SessionId: session.ID,
+		ExamId:    session.ExamID,
+		GroupId:   session.GroupID,
+		Finished:  session.FinishedAt != nil,
+		Total:     len(session.Questions),
+		Missed:    []types.GameSessionMissedItem{},
+	}
+
+	for _, question := range session.Questions {
+		if !question.Answered {
+			continue
+		}
+
+		report.Answered++
+		if question.Correct {
+			report.Correct++
+			continue
+		}
+
+		report.Wrong++
+		report.Missed = append(report.Missed, types.GameSessionMissedItem{
+			ItemId: question.ItemID,
+			Name:   question.Item.Name,
+			Image:  question.Item.Image,
+			Answer: question.Answer,
+		})
+	}
+
+	if report.Answered > 0 {
+		report.Percentage = int(math.Round((float64(report.Correct) / float64(report.Answered)) * 100))
+	}
+
+	end := now
+	if session.FinishedAt != nil {
+		end = *session.FinishedAt
+	}
+	report.TimeTakenMs = end.Sub(session.CreatedAt).Milliseconds()
+
+	return report
+}
@@ -0,0 +1,174 @@
+package game
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"recognizer/db"
+	"recognizer/types"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/google/uuid"
+	"gorm.io/gorm/clause"
+)
+
+// Questions have to be answered within this time after they were served, on top of the time limit of the exam
+const ticketLifetime = 5 * time.Minute
+
+var (
+	errTicketInvalid  = errors.New("Invalid question ticket")
+	errTicketExpired  = errors.New("Question ticket has expired")
+	errTicketUsed     = errors.New("Question ticket was already used")
+	errTicketMismatch = errors.New("Question ticket does not match the answer")
+)
+
+// ticketClaims bind a served question to the user it was served to
+type ticketClaims struct {
+	Type    string   `json:"type"`
+	UserID  uint     `json:"userId"`
+	ItemID  uint     `json:"itemId"`
+	Answers []string `json:"answers"`
+	// Image of the item shown in the question, zero when the item has no image list
+	ImageID uint   `json:"imageId,omitempty"`
+	Name    string `json:"name,omitempty"`
+	// Items offered by the question, the correct one is hidden behind its keyed hash when the question hides its item
+	Options  []uint `json:"options,omitempty"`
+	ItemHash string `json:"itemHash,omitempty"`
+	// Unix milliseconds, the issue time of the token is only in seconds
+	ServedAt  int64 `json:"servedAt"`
+	TimeLimit int   `json:"timeLimit"`
+	// Recorded with the answer
+	Filter *db.PracticeFilter `json:"filter,omitempty"`
+	jwt.StandardClaims
+}
+
+func ticketSecret() []byte {
+	if secret := os.Getenv("TICKET_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+
+	return []byte("supersafeticketsecret")
+}
+
+// issueTicket signs a single use ticket for the question served to the user
+// The claims of the ticket can be read by the client, so it must not tell which option of a reverse question is correct.
+func issueTicket(userId uint, itemId uint, imageId uint, question types.GameResponse, filter *db.PracticeFilter, now time.Time) (string, error) {
+	claims := ticketClaims{
+		Filter:    filter,
+		Type:      question.Type,
+		UserID:    userId,
+		ItemID:    itemId,
+		ImageID:   imageId,
+		Name:      question.Name,
+		Answers:   question.Answers,
+		ServedAt:  now.UnixMilli(),
+		TimeLimit: question.TimeLimit,
+		StandardClaims: jwt.StandardClaims{
+			Id:        uuid.New().String(),
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(ticketLifetime + time.Duration(question.TimeLimit)*time.Second).Unix(),
+		},
+	}
+
+	for _, option := range question.Options {
+		claims.Options = append(claims.Options, option.ItemId)
+	}
+
+	// Questions leaving out their item would give it away with the ticket too
+	if question.ItemId == 0 {
+		claims.ItemID = 0
+		claims.ItemHash = itemHash(claims.Id, itemId)
+	}
+
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(ticketSecret())
+}
+
+// parseTicket verifies the signature and expiry of the ticket
+func parseTicket(ticket string) (*ticketClaims, error) {
+	claims := &ticketClaims{}
+	_, err := jwt.ParseWithClaims(ticket, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return ticketSecret(), nil
+	})
+
+	var validationErr *jwt.ValidationError
+	if errors.As(err, &validationErr) && validationErr.Errors&jwt.ValidationErrorExpired != 0 {
+		return nil, errTicketExpired
+	}
+
+	if err != nil || claims.Id == "" {
+		return nil, errTicketInvalid
+	}
+
+	return claims, nil
+}
+
+// questionItem returns the item the question of the ticket was about
+func (claims *ticketClaims) questionItem() (uint, error) {
+	if claims.ItemHash == "" {
+		return claims.ItemID, nil
+	}
+
+	for _, option := range claims.Options {
+		if hmac.Equal([]byte(itemHash(claims.Id, option)), []byte(claims.ItemHash)) {
+			return option, nil
+		}
+	}
+
+	return 0, errTicketInvalid
+}
+
+func itemHash(ticketId string, itemId uint) string {
+	mac := hmac.New(sha256.New, ticketSecret())
+	fmt.Fprintf(mac, "%s:%d", ticketId, itemId)
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// checkTicket makes sure the answer is about a question the user was actually served, the generator checks the answer itself
+func checkTicket(claims *ticketClaims, userId uint, itemId uint) error {
+	if claims.UserID != userId {
+		return errTicketMismatch
+	}
+
+	// A hidden item was already resolved from the hash
+	if claims.ItemHash == "" && claims.ItemID != itemId {
+		return errTicketMismatch
+	}
+
+	return nil
+}
+
+// issued returns the question the ticket was issued for
+func (claims *ticketClaims) issued() IssuedQuestion {
+	return IssuedQuestion{
+		Type:    claims.Type,
+		Answers: claims.Answers,
+		Options: claims.Options,
+		Name:    claims.Name,
+	}
+}
+
+// useTicket marks the ticket as used, a ticket can only be used once
+func (service *Service) useTicket(claims *ticketClaims) error {
+	res := service.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&db.UsedTicket{
+		TicketID: claims.Id,
+		UserID:   claims.UserID,
+	})
+
+	if res.Error != nil {
+		return res.Error
+	}
+
+	if res.RowsAffected == 0 {
+		return errTicketUsed
+	}
+
+	return nil
+}
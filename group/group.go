@@ -3,6 +3,7 @@ package group
 import (
 	"errors"
 	"net/http"
+	"recognizer/access"
 	"recognizer/db"
 	"recognizer/types"
 	"strconv"
@@ -37,7 +38,7 @@ func (service *Service) CreateGroup(c *gin.Context) {
 	}
 
 	// Authorization check
-	if foundExam.UserID != c.MustGet("userId").(uint){
+	if allowed, err := access.Can(service.DB, foundExam, c.MustGet("userId").(uint), types.RoleEditor); err != nil || !allowed {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
@@ -83,7 +84,7 @@ func (service *Service) UpdateGroup(c *gin.Context) {
 		return
 	}
 
-	if foundGroup.Exam.UserID != c.MustGet("userId").(uint){
+	if allowed, err := access.Can(service.DB, &foundGroup.Exam, c.MustGet("userId").(uint), types.RoleEditor); err != nil || !allowed {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
@@ -109,6 +110,16 @@ func (service *Service) ListGroups(c *gin.Context) {
 		return
 	}
 
+	_, err = access.FindExam(service.DB, uint(examIdParam), c.MustGet("userId").(uint))
+	if errors.Is(err, access.ErrExamNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Exam not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error loading exam"})
+		return
+	}
+
 	var groups []db.Group
 	service.DB.Where("exam_id = ?", uint(examIdParam)).Find(&groups)
 
@@ -130,7 +141,7 @@ func (service *Service) DeleteGroup(c *gin.Context) {
 		return
 	}
 
-	if foundGroup.Exam.UserID != c.MustGet("userId").(uint){
+	if allowed, err := access.Can(service.DB, &foundGroup.Exam, c.MustGet("userId").(uint), types.RoleEditor); err != nil || !allowed {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
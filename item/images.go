@@ -0,0 +1,158 @@
+package item
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"recognizer/access"
+	"recognizer/db"
+	"recognizer/types"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var errMixedMedia = errors.New("All media of an item have to be of the same kind")
+
+// mediaTypeOf returns the kind of media the files are of, files uploaded before there were other kinds are images
+func mediaTypeOf(tx *gorm.DB, keys []string) (string, error) {
+	var mediaFiles []db.MediaFile
+	if err := tx.Where("key IN ?", keys).Find(&mediaFiles).Error; err != nil {
+		return "", err
+	}
+
+	mediaTypes := make(map[string]string, len(mediaFiles))
+	for _, mediaFile := range mediaFiles {
+		mediaTypes[mediaFile.Key] = mediaFile.MediaType
+	}
+
+	mediaType := ""
+	for _, key := range keys {
+		keyType, ok := mediaTypes[key]
+		if !ok {
+			keyType = types.MediaImage
+		}
+
+		if mediaType != "" && keyType != mediaType {
+			return "", errMixedMedia
+		}
+		mediaType = keyType
+	}
+
+	if mediaType == "" {
+		return types.MediaImage, nil
+	}
+
+	return mediaType, nil
+}
+
+// mediaKeys lists the keys of all the media an item is saved with
+func mediaKeys(image string, images []types.ItemImageDto) []string {
+	var keys []string
+	if image != "" {
+		keys = append(keys, image)
+	}
+	for _, itemImage := range images {
+		keys = append(keys, itemImage.Image)
+	}
+
+	return keys
+}
+
+func orderedImages(tx *gorm.DB) *gorm.DB {
+	return tx.Order("position")
+}
+
+// replaceImages makes the images of the item match the list, the first image becomes the image of the item.
+// Images of the list with the id of an existing image update it, the existing ones missing from the list are deleted.
+func replaceImages(tx *gorm.DB, item *db.Item, images []types.ItemImageDto) error {
+	var existing []db.ItemImage
+	if err := tx.Where("item_id = ?", item.ID).Find(&existing).Error; err != nil {
+		return err
+	}
+
+	existingById := make(map[uint]db.ItemImage, len(existing))
+	for _, image := range existing {
+		existingById[image.ID] = image
+	}
+
+	kept := map[uint]bool{}
+	for position, data := range images {
+		image, ok := existingById[data.Id]
+		if !ok {
+			image = db.ItemImage{ItemID: item.ID}
+		}
+
+		image.Image = data.Image
+		image.Caption = data.Caption
+		image.Position = position
+
+		if err := tx.Save(&image).Error; err != nil {
+			return err
+		}
+		kept[image.ID] = true
+	}
+
+	for _, image := range existing {
+		if !kept[image.ID] {
+			if err := tx.Delete(&image).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(images) > 0 {
+		item.Image = images[0].Image
+		return tx.Model(item).Update("image", item.Image).Error
+	}
+
+	return nil
+}
+
+// ListImageStats shows how often each image of the exam was answered right, the most misleading images first
+func (service *Service) ListImageStats(c *gin.Context) {
+	examIdParam, err := strconv.ParseUint(c.Param("examId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	_, err = access.FindExam(service.DB, uint(examIdParam), c.MustGet("userId").(uint))
+	if errors.Is(err, access.ErrExamNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Exam not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading exam"})
+		return
+	}
+
+	var data []types.ImageStats
+	err = service.DB.Model(&db.ItemImage{}).
+		Select("item_images.id as image_id, item_images.item_id, items.name, item_images.image, item_images.caption, "+
+			"CAST(COUNT(score_points.id) AS INT) as answers, "+
+			"CAST(SUM(CASE WHEN score_points.correct THEN 1 ELSE 0 END) AS INT) as correct",
+		).
+		Joins("INNER JOIN items ON items.id = item_images.item_id AND items.deleted_at IS NULL").
+		Joins("LEFT JOIN score_points ON score_points.image_id = item_images.id AND score_points.deleted_at IS NULL").
+		Where("items.exam_id = ?", uint(examIdParam)).
+		Group("item_images.id, items.name").
+		Order("CAST(SUM(CASE WHEN score_points.correct THEN 1 ELSE 0 END) AS FLOAT) / NULLIF(COUNT(score_points.id), 0) ASC NULLS LAST, item_images.id").
+		Scan(&data).Error
+
+	if err != nil {
+		fmt.Println(err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error querying database"})
+		return
+	}
+
+	for i, image := range data {
+		if image.Answers > 0 {
+			data[i].Accuracy = int(math.Round(float64(image.Correct) / float64(image.Answers) * 100))
+		}
+	}
+
+	c.JSON(200, data)
+}
@@ -3,6 +3,7 @@ package item
 import (
 	"errors"
 	"net/http"
+	"recognizer/access"
 	"recognizer/db"
 	"recognizer/types"
 	"strconv"
@@ -37,7 +38,7 @@ func (service *Service) CreateItem(c *gin.Context) {
 		return
 	}
 
-	if exam.UserID != c.MustGet("userId").(uint) {
+	if allowed, err := access.Can(service.DB, exam, c.MustGet("userId").(uint), types.RoleEditor); err != nil || !allowed {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
@@ -56,15 +57,44 @@ func (service *Service) CreateItem(c *gin.Context) {
         return
     }
 
+	// With a list of images the first one replaces the image
+	image := data.Image
+	if len(data.Images) > 0 {
+		image = data.Images[0].Image
+	}
+
+	mediaType, err := mediaTypeOf(service.DB, mediaKeys(image, data.Images))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	itemToCreate := db.Item{
-		Name:    data.Name,
-		Image:   data.Image,
-		GroupID: data.GroupId,
-		ExamID:  data.ExamId,
+		Name:      data.Name,
+		Image:     image,
+		Aliases:   data.Aliases,
+		GroupID:   data.GroupId,
+		ExamID:    data.ExamId,
+		MediaType: mediaType,
 	}
 
-	service.DB.Create(&itemToCreate)
-	service.DB.First(&itemToCreate)
+	// The item and its images are saved together or not at all
+	err = service.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&itemToCreate).Error; err != nil {
+			return err
+		}
+
+		if len(data.Images) > 0 {
+			return replaceImages(tx, &itemToCreate, data.Images)
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating item"})
+		return
+	}
+
+	service.DB.Preload("Images", orderedImages).First(&itemToCreate)
 
 	c.JSON(200, itemToCreate)
 }
@@ -92,17 +122,49 @@ func (service *Service) UpdateItem(c *gin.Context) {
 	}
 
 	// Authorization check
-	if foundItem.Exam.UserID != c.MustGet("userId").(uint){
+	if allowed, err := access.Can(service.DB, &foundItem.Exam, c.MustGet("userId").(uint), types.RoleEditor); err != nil || !allowed {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
 
+	var images []types.ItemImageDto
+	if data.Images != nil {
+		images = *data.Images
+	} else {
+		// The first image is kept as the image, so the order has to be the display order
+		service.DB.Model(&db.ItemImage{}).Select("image").Where("item_id = ?", foundItem.ID).Order("position").Scan(&images)
+	}
+
+	image := data.Image
+	if len(images) > 0 {
+		image = images[0].Image
+	}
+
+	mediaType, err := mediaTypeOf(service.DB, mediaKeys(image, images))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	foundItem.Name = data.Name
 	foundItem.GroupID = data.GroupId
-	foundItem.Image = data.Image
+	foundItem.Image = image
+	foundItem.Aliases = data.Aliases
+	foundItem.MediaType = mediaType
 
 	service.DB.Save(&foundItem)
-	service.DB.First(&foundItem)
+
+	if data.Images != nil {
+		err := service.DB.Transaction(func(tx *gorm.DB) error {
+			return replaceImages(tx, foundItem, *data.Images)
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving images"})
+			return
+		}
+	}
+
+	service.DB.Preload("Images", orderedImages).First(&foundItem)
 
 	c.JSON(200, foundItem)
 }
@@ -115,13 +177,24 @@ func (service *Service) GetItem(c *gin.Context) {
 	}
 
 	var foundItem *db.Item
-	res := service.DB.First(&foundItem, uint(itemIdParam))
+	res := service.DB.Preload("Images", orderedImages).First(&foundItem, uint(itemIdParam))
 
 	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
 		return
 	}
 
+	// Items of exams the user can't see are not found either
+	_, err = access.FindExam(service.DB, foundItem.ExamID, c.MustGet("userId").(uint))
+	if errors.Is(err, access.ErrExamNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading exam"})
+		return
+	}
+
 	c.JSON(200, foundItem)
 }
 
@@ -141,7 +214,7 @@ func (service *Service) DeleteItem(c *gin.Context) {
 	}
 
 	// Authorization check
-	if foundItem.Exam.UserID != c.MustGet("userId").(uint){
+	if allowed, err := access.Can(service.DB, &foundItem.Exam, c.MustGet("userId").(uint), types.RoleEditor); err != nil || !allowed {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
@@ -159,8 +232,18 @@ func (service *Service) ListItems(c *gin.Context) {
 		return
 	}
 
+	_, err = access.FindExam(service.DB, uint(examIdParam), c.MustGet("userId").(uint))
+	if errors.Is(err, access.ErrExamNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Exam not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading exam"})
+		return
+	}
+
 	var items []db.Item
-	service.DB.Where("exam_id = ?", uint(examIdParam)).Find(&items)
+	service.DB.Preload("Images", orderedImages).Where("exam_id = ?", uint(examIdParam)).Find(&items)
 
 	c.JSON(200, items)
 }
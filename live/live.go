@@ -0,0 +1,234 @@
+package live
+
+import (
+	"errors"
+	"net/http"
+	"recognizer/access"
+	"recognizer/db"
+	"recognizer/types"
+	"recognizer/user"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	writeWait      = 10 * time.Second
+	pongWait       = 60 * time.Second
+	pingPeriod     = pongWait * 9 / 10
+	maxMessageSize = 1024
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	// Same as the CORS config, every origin is allowed
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+type Service struct {
+	types.ServiceConfig
+	rooms *roomManager
+}
+
+func NewLiveService(config types.ServiceConfig) Service {
+	return Service{config, newRoomManager()}
+}
+
+func (service *Service) CreateRoom(c *gin.Context) {
+	// Guests can join rooms but not host them
+	if c.GetBool("guest") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Sign up to host a live room"})
+		return
+	}
+
+	var data types.CreateLiveRoom
+
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	foundExam, err := access.FindExam(service.DB, data.ExamId, c.MustGet("userId").(uint))
+	if errors.Is(err, access.ErrExamNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading exam"})
+		return
+	}
+
+	var items []*db.Item
+	service.DB.Where("exam_id = ?", data.ExamId).Find(&items)
+
+	if len(items) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No items in this exam"})
+		return
+	}
+
+	roundSeconds := data.RoundSeconds
+	if roundSeconds == 0 {
+		roundSeconds = defaultRoundSeconds
+	}
+
+	created, err := service.rooms.create(service.DB, foundExam, items, c.MustGet("userId").(uint), roundSeconds)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating room"})
+		return
+	}
+
+	c.JSON(http.StatusOK, types.LiveRoomResponse{
+		Code:         created.code,
+		ExamId:       created.examId,
+		RoundSeconds: created.roundSeconds,
+	})
+}
+
+// JoinRoom upgrades the request to a WebSocket connection of the room.
+// Browsers can't set headers on WebSocket requests, so the token can also come in the query.
+func (service *Service) JoinRoom(c *gin.Context) {
+	tokenString := c.GetHeader("Authorization")
+	if tokenString == "" {
+		tokenString = c.Query("token")
+	}
+
+	// Guests can play along too
+	userService := user.NewUserService(service.ServiceConfig)
+	userId, _, err := userService.ParsePlayToken(tokenString)
+	if err != nil {
+		c.JSON(403, "Invalid token")
+		return
+	}
+
+	joinedRoom := service.rooms.get(c.Param("code"))
+	if joinedRoom == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+		return
+	}
+
+	// The code of the room doesn't share the exam, players have to be able to see it already
+	_, err = access.FindExam(service.DB, joinedRoom.examId, userId)
+	if errors.Is(err, access.ErrExamNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading exam"})
+		return
+	}
+
+	var foundUser db.User
+	service.DB.First(&foundUser, userId)
+
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// The upgrader already responded with the error
+		return
+	}
+
+	joined := &client{
+		userId:   userId,
+		username: foundUser.Username,
+		conn:     conn,
+		send:     make(chan types.LiveEvent, 16),
+	}
+	go joined.writePump()
+
+	if err := joinedRoom.join(joined); err != nil {
+		joined.push(types.LiveEvent{Type: types.LiveError, Error: err.Error()})
+		joined.close()
+		return
+	}
+
+	joined.readPump(joinedRoom)
+}
+
+// client is a single WebSocket connection to a room
+type client struct {
+	userId   uint
+	username string
+	conn     *websocket.Conn
+	send     chan types.LiveEvent
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// push queues the event without blocking, a client that can't keep up is disconnected
+func (cl *client) push(event types.LiveEvent) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	if cl.closed {
+		return
+	}
+
+	select {
+	case cl.send <- event:
+	default:
+		cl.closed = true
+		close(cl.send)
+	}
+}
+
+func (cl *client) close() {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	if !cl.closed {
+		cl.closed = true
+		close(cl.send)
+	}
+}
+
+func (cl *client) readPump(joinedRoom *room) {
+	defer joinedRoom.leave(cl)
+
+	cl.conn.SetReadLimit(maxMessageSize)
+	_ = cl.conn.SetReadDeadline(time.Now().Add(pongWait))
+	cl.conn.SetPongHandler(func(string) error {
+		return cl.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		var message types.LiveMessage
+		if err := cl.conn.ReadJSON(&message); err != nil {
+			return
+		}
+
+		if err := joinedRoom.handle(cl, message); err != nil {
+			cl.push(types.LiveEvent{Type: types.LiveError, Error: err.Error()})
+		}
+	}
+}
+
+func (cl *client) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		cl.conn.Close()
+	}()
+
+	for {
+		select {
+		case event, ok := <-cl.send:
+			_ = cl.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				_ = cl.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+
+			if err := cl.conn.WriteJSON(event); err != nil {
+				return
+			}
+		case <-ticker.C:
+			_ = cl.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := cl.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
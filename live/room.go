@@ -0,0 +1,553 @@
+package live
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	mathrand "math/rand"
+	"recognizer/db"
+	"recognizer/game"
+	"recognizer/scoring"
+	"recognizer/types"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	codeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	codeLength   = 6
+
+	defaultRoundSeconds = 20
+
+	// Correct answers get the base points and up to the same amount again for speed
+	basePoints  = 500
+	speedPoints = 500
+
+	// Rooms nobody finished are ended after this time
+	roomLifetime = 3 * time.Hour
+	// Rooms are checked for their lifetime this often
+	evictionInterval = time.Minute
+	// The room ends when its host doesn't reconnect within this time
+	hostReconnectWait = 2 * time.Minute
+
+	// Answers of a finished room are written this many times before they are given up
+	storeAttempts  = 3
+	storeRetryWait = 2 * time.Second
+)
+
+var (
+	errNotHost         = errors.New("Only the host can control the room")
+	errHostCantAnswer  = errors.New("The host can't answer questions")
+	errNoOpenRound     = errors.New("There is no open question")
+	errAlreadyAnswered = errors.New("You already answered this question")
+	errRoomFinished    = errors.New("The room is already finished")
+)
+
+// roomManager keeps the live rooms in memory, they only live as long as the process
+type roomManager struct {
+	mu    sync.Mutex
+	rooms map[string]*room
+}
+
+func newRoomManager() *roomManager {
+	manager := &roomManager{rooms: map[string]*room{}}
+	go manager.evictLoop()
+
+	return manager
+}
+
+// evictLoop ends the rooms that outlived their lifetime, their answers are stored like the ones of a room the host ended
+func (manager *roomManager) evictLoop() {
+	for now := range time.Tick(evictionInterval) {
+		manager.evict(now)
+	}
+}
+
+func (manager *roomManager) evict(now time.Time) {
+	manager.mu.Lock()
+	var expired []*room
+	for _, existing := range manager.rooms {
+		if now.Sub(existing.createdAt) > roomLifetime {
+			expired = append(expired, existing)
+		}
+	}
+	manager.mu.Unlock()
+
+	// Ending a room removes it from the manager, so it can't happen under its lock
+	for _, existing := range expired {
+		existing.end()
+	}
+}
+
+func (manager *roomManager) create(database *gorm.DB, exam *db.Exam, items []*db.Item, hostId uint, roundSeconds int) (*room, error) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	code, err := newCode()
+	for err == nil && manager.rooms[code] != nil {
+		code, err = newCode()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	created := &room{
+		code:         code,
+		db:           database,
+		manager:      manager,
+		exam:         exam,
+		examId:       exam.ID,
+		hostId:       hostId,
+		roundSeconds: roundSeconds,
+		items:        items,
+		used:         map[uint]bool{},
+		clients:      map[uint]*client{},
+		players:      map[uint]*player{},
+		createdAt:    time.Now(),
+	}
+	manager.rooms[code] = created
+
+	return created, nil
+}
+
+func (manager *roomManager) get(code string) *room {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	return manager.rooms[code]
+}
+
+func (manager *roomManager) remove(code string) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	delete(manager.rooms, code)
+}
+
+func newCode() (string, error) {
+	code := make([]byte, codeLength)
+	for i := range code {
+		index, err := rand.Int(rand.Reader, big.NewInt(int64(len(codeAlphabet))))
+		if err != nil {
+			return "", err
+		}
+		code[i] = codeAlphabet[index.Int64()]
+	}
+
+	return string(code), nil
+}
+
+// player is the score of one user in a room, it survives reconnects
+type player struct {
+	userId   uint
+	username string
+	points   int
+	correct  int
+}
+
+type liveAnswer struct {
+	userId         uint
+	item           *db.Item
+	correct        bool
+	confusedWithId uint
+	servedAt       time.Time
+	answeredAt     time.Time
+}
+
+type room struct {
+	mu sync.Mutex
+
+	code         string
+	db           *gorm.DB
+	manager      *roomManager
+	exam         *db.Exam
+	examId       uint
+	hostId       uint
+	roundSeconds int
+	items        []*db.Item
+	used         map[uint]bool
+	clients      map[uint]*client
+	players      map[uint]*player
+	createdAt    time.Time
+	finished     bool
+	hostTimer    *time.Timer
+
+	// The open round, current is nil between rounds
+	round        int
+	current      *db.Item
+	question     types.GameResponse
+	roundStarted time.Time
+	roundTimer   *time.Timer
+	roundAnswers map[uint]bool
+
+	answers []liveAnswer
+}
+
+func (r *room) join(joined *client) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.finished {
+		return errRoomFinished
+	}
+
+	// A new connection of the same user replaces the old one
+	if previous, ok := r.clients[joined.userId]; ok {
+		previous.close()
+	}
+	r.clients[joined.userId] = joined
+
+	if joined.userId == r.hostId && r.hostTimer != nil {
+		r.hostTimer.Stop()
+		r.hostTimer = nil
+	}
+
+	if joined.userId != r.hostId && r.players[joined.userId] == nil {
+		r.players[joined.userId] = &player{userId: joined.userId, username: joined.username}
+	}
+
+	r.broadcast(types.LiveEvent{Type: types.LivePlayers, Players: r.playerNames()})
+
+	// Late joiners get the open question straight away
+	if r.current != nil && joined.userId != r.hostId {
+		joined.push(r.questionEvent())
+	}
+
+	return nil
+}
+
+func (r *room) leave(left *client) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.clients[left.userId] == left {
+		delete(r.clients, left.userId)
+
+		// A room whose host is gone for good is ended, so its answers aren't lost
+		if left.userId == r.hostId && !r.finished {
+			r.hostTimer = time.AfterFunc(hostReconnectWait, func() {
+				r.mu.Lock()
+				defer r.mu.Unlock()
+
+				if !r.finished && r.clients[r.hostId] == nil {
+					r.finish()
+				}
+			})
+		}
+	}
+	left.close()
+}
+
+// end finishes the room unless it is already finished
+func (r *room) end() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.finished {
+		r.finish()
+	}
+}
+
+func (r *room) handle(from *client, message types.LiveMessage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.finished {
+		return errRoomFinished
+	}
+
+	switch message.Type {
+	case types.LiveNext:
+		if from.userId != r.hostId {
+			return errNotHost
+		}
+		r.nextRound()
+	case types.LiveEnd:
+		if from.userId != r.hostId {
+			return errNotHost
+		}
+		r.finish()
+	case types.LiveAnswer:
+		return r.answer(from, message.Answer)
+	default:
+		return fmt.Errorf("Unknown message type %q", message.Type)
+	}
+
+	return nil
+}
+
+// nextRound closes the open round and serves the same new question to everyone, the room ends when the items run out
+func (r *room) nextRound() {
+	if r.current != nil {
+		r.closeRound()
+	}
+
+	var remaining []*db.Item
+	for _, item := range r.items {
+		if !r.used[item.ID] {
+			remaining = append(remaining, item)
+		}
+	}
+
+	if len(remaining) == 0 {
+		r.finish()
+		return
+	}
+
+	r.round++
+	r.current = remaining[mathrand.Intn(len(remaining))]
+	r.used[r.current.ID] = true
+	source, err := game.NewQuestionSource(r.db, r.exam, r.items, r.current)
+	if err != nil {
+		// The question still works without the confusions
+		fmt.Println(err.Error())
+		source = game.QuestionSource{Exam: r.exam, Items: r.items}
+	}
+	r.question = game.NewQuestion(source, r.current)
+	if err := game.DescribeMedia(r.db, &r.question); err != nil {
+		fmt.Println(err.Error())
+	}
+	r.roundStarted = time.Now()
+	r.roundAnswers = map[uint]bool{}
+
+	round := r.round
+	r.roundTimer = time.AfterFunc(time.Duration(r.roundSeconds)*time.Second, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		if r.round == round && r.current != nil {
+			r.closeRound()
+		}
+	})
+
+	r.broadcast(r.questionEvent())
+}
+
+func (r *room) answer(from *client, answer string) error {
+	if from.userId == r.hostId {
+		return errHostCantAnswer
+	}
+
+	if r.current == nil {
+		return errNoOpenRound
+	}
+
+	if r.roundAnswers[from.userId] {
+		return errAlreadyAnswered
+	}
+	r.roundAnswers[from.userId] = true
+
+	now := time.Now()
+	isCorrect := r.current.Name == answer
+
+	var confusedWithId uint
+	if !isCorrect {
+		if confusedWith := game.FindItemByName(r.exam, r.items, r.current, answer); confusedWith != nil {
+			confusedWithId = confusedWith.ID
+		}
+	}
+
+	answering := r.players[from.userId]
+	if isCorrect {
+		limit := time.Duration(r.roundSeconds) * time.Second
+		remaining := limit - now.Sub(r.roundStarted)
+		if remaining < 0 {
+			remaining = 0
+		}
+
+		answering.points += basePoints + int(float64(speedPoints)*float64(remaining)/float64(limit))
+		answering.correct++
+	}
+
+	r.answers = append(r.answers, liveAnswer{
+		userId:         from.userId,
+		item:           r.current,
+		correct:        isCorrect,
+		confusedWithId: confusedWithId,
+		servedAt:       r.roundStarted,
+		answeredAt:     now,
+	})
+
+	from.push(types.LiveEvent{Type: types.LiveAnswered, Round: r.round, Correct: &isCorrect})
+
+	// No need to wait for the timer once everyone answered
+	if len(r.roundAnswers) >= len(r.players) {
+		r.closeRound()
+	}
+
+	return nil
+}
+
+// closeRound reveals the answer and pushes the leaderboard
+func (r *room) closeRound() {
+	if r.roundTimer != nil {
+		r.roundTimer.Stop()
+	}
+
+	r.broadcast(types.LiveEvent{
+		Type:        types.LiveRoundResult,
+		Round:       r.round,
+		Answer:      r.current.Name,
+		Leaderboard: r.leaderboard(),
+	})
+
+	r.current = nil
+}
+
+// finish disconnects everyone and stores the answers of the room in the background, so the room isn't held up by the writes
+func (r *room) finish() {
+	if r.current != nil {
+		r.closeRound()
+	}
+	r.finished = true
+
+	if len(r.answers) > 0 {
+		scorePoints := make([]db.ScorePoint, 0, len(r.answers))
+		confusions := make(map[*db.Item][]uint, len(r.answers))
+		for _, answer := range r.answers {
+			servedAt, answeredAt := answer.servedAt, answer.answeredAt
+			scorePoints = append(scorePoints, db.ScorePoint{
+				UserID:         answer.userId,
+				ExamID:         r.examId,
+				ItemID:         answer.item.ID,
+				Correct:        answer.correct,
+				ServedAt:       &servedAt,
+				AnsweredAt:     &answeredAt,
+				ResponseMs:     answeredAt.Sub(servedAt).Milliseconds(),
+				ScoringVersion: r.exam.ScoringVersion,
+			})
+
+			if answer.confusedWithId != 0 {
+				confusions[answer.item] = append(confusions[answer.item], answer.confusedWithId)
+			}
+		}
+
+		go r.store(scorePoints, confusions)
+	}
+
+	r.broadcast(types.LiveEvent{Type: types.LiveFinished, Round: r.round, Leaderboard: r.leaderboard()})
+
+	for _, connected := range r.clients {
+		connected.close()
+	}
+	r.manager.remove(r.code)
+}
+
+// store saves the answers of a finished room, a failed write is tried again before the answers are given up
+func (r *room) store(scorePoints []db.ScorePoint, confusions map[*db.Item][]uint) {
+	for attempt := 1; attempt <= storeAttempts; attempt++ {
+		err := r.db.Transaction(func(tx *gorm.DB) error {
+			return r.storeAnswers(tx, scorePoints, confusions)
+		})
+		if err == nil {
+			return
+		}
+
+		fmt.Printf("Storing %d answers of live room %s failed (attempt %d of %d): %s\n", len(scorePoints), r.code, attempt, storeAttempts, err.Error())
+		if attempt < storeAttempts {
+			time.Sleep(time.Duration(attempt) * storeRetryWait)
+		}
+	}
+}
+
+// storeAnswers scores the answers of the room and writes them with the confusions they showed
+func (r *room) storeAnswers(tx *gorm.DB, scorePoints []db.ScorePoint, confusions map[*db.Item][]uint) error {
+	// The answers of the room aren't stored yet, so the streaks continue from the stored ones here
+	streaks := map[uint]int{}
+	for i := range scorePoints {
+		// A failed attempt may have numbered the rows already
+		scorePoint := &scorePoints[i]
+		scorePoint.ID = 0
+
+		streak, ok := streaks[scorePoint.UserID]
+		if !ok && r.exam.Scoring.StreakBonus > 0 {
+			var err error
+			if streak, err = scoring.Streak(tx, scorePoint.UserID, r.examId, *scorePoint.AnsweredAt); err != nil {
+				return err
+			}
+		}
+
+		scorePoint.Points = scoring.Points(r.exam, scoring.Answer{Correct: scorePoint.Correct, ResponseMs: scorePoint.ResponseMs}, streak)
+
+		if scorePoint.Correct {
+			streaks[scorePoint.UserID] = streak + 1
+		} else {
+			streaks[scorePoint.UserID] = 0
+		}
+	}
+
+	if err := tx.Create(&scorePoints).Error; err != nil {
+		return err
+	}
+
+	for item, confusedWithIds := range confusions {
+		for _, confusedWithId := range confusedWithIds {
+			if err := game.RecordConfusion(tx, item, confusedWithId); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (r *room) questionEvent() types.LiveEvent {
+	question := r.question
+	endsAt := r.roundStarted.Add(time.Duration(r.roundSeconds) * time.Second)
+
+	return types.LiveEvent{
+		Type:     types.LiveQuestion,
+		Round:    r.round,
+		Question: &question,
+		EndsAt:   &endsAt,
+	}
+}
+
+func (r *room) broadcast(event types.LiveEvent) {
+	for _, connected := range r.clients {
+		connected.push(event)
+	}
+}
+
+func (r *room) playerNames() []string {
+	names := make([]string, 0, len(r.players))
+	for _, joined := range r.players {
+		names = append(names, joined.username)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func (r *room) leaderboard() []types.LiveLeaderboardItem {
+	leaderboard := make([]types.LiveLeaderboardItem, 0, len(r.players))
+	for _, joined := range r.players {
+		leaderboard = append(leaderboard, types.LiveLeaderboardItem{
+			UserId:   joined.userId,
+			Username: joined.username,
+			Points:   joined.points,
+			Correct:  joined.correct,
+		})
+	}
+
+	sort.Slice(leaderboard, func(i, j int) bool {
+		if leaderboard[i].Points != leaderboard[j].Points {
+			return leaderboard[i].Points > leaderboard[j].Points
+		}
+		return leaderboard[i].Username < leaderboard[j].Username
+	})
+
+	// Players with the same points share the rank
+	for i := range leaderboard {
+		leaderboard[i].Rank = i + 1
+		if i > 0 && leaderboard[i].Points == leaderboard[i-1].Points {
+			leaderboard[i].Rank = leaderboard[i-1].Rank
+		}
+	}
+
+	return leaderboard
+}
@@ -1,12 +1,14 @@
 package main
 
 import (
+	"recognizer/assessment"
 	"recognizer/db"
 	"recognizer/exam"
 	"recognizer/files"
 	"recognizer/game"
 	"recognizer/group"
 	"recognizer/item"
+	"recognizer/live"
 	"recognizer/types"
 	"recognizer/user"
 
@@ -52,9 +54,10 @@ func main() {
 	*/
 	userService := user.NewUserService(config)
 	userGroup := r.Group("/user")
-	userGroup.GET("current", AuthMiddleware(), userService.GetCurrentUser)
+	userGroup.GET("current", userService.PlayMiddleware(), userService.GetCurrentUser)
 	userGroup.POST("create", userService.CreateUser)
 	userGroup.POST("login", userService.LoginUser)
+	userGroup.POST("guest", userService.CreateGuest)
 
 	/*
 		Exams
@@ -64,10 +67,26 @@ func main() {
 	examGroups.Use(AuthMiddleware())
 	examGroups.POST("", examService.CreateExam)
 	examGroups.PUT(":examId", examService.UpdateExam)
+	examGroups.POST(":examId/clone", examService.CloneExam)
 	examGroups.GET(":examId", examService.GetExam)
 	examGroups.GET("/stats/:examId", examService.GetExamStats)
+	examGroups.GET("/ratings/:examId", examService.GetExamRatings)
+	examGroups.GET("/daily/:examId", examService.ListDailyChallenges)
+	examGroups.GET("/daily/:examId/leaderboard", examService.GetDailyLeaderboard)
+	examGroups.GET("/share/:examId", examService.ListShareLinks)
+	examGroups.POST("/share/:examId", examService.CreateShareLink)
+	examGroups.DELETE("/share/:examId/:linkId", examService.RevokeShareLink)
+	examGroups.GET("/members/:examId", examService.ListMembers)
+	examGroups.POST("/members/:examId", examService.InviteMember)
+	examGroups.PUT("/members/:examId/:memberId", examService.UpdateMember)
+	examGroups.DELETE("/members/:examId/:memberId", examService.RemoveMember)
+	examGroups.GET("/invitations", examService.ListInvitations)
+	examGroups.POST("/invitations/:memberId/accept", examService.AcceptInvitation)
+	examGroups.DELETE("/invitations/:memberId", examService.DeclineInvitation)
 	examGroups.DELETE(":examId", examService.DeleteExam)
 	examGroups.GET("", examService.ListExams)
+	// Guests can open share links too
+	r.POST("/exam/shared/:token", userService.PlayMiddleware(), examService.OpenShareLink)
 
 	/*
 		Groups
@@ -91,15 +110,47 @@ func main() {
 	itemGroup.GET(":itemId", itemsService.GetItem)
 	itemGroup.DELETE(":itemId", itemsService.DeleteItem)
 	itemGroup.GET("/by-exam/:examId", itemsService.ListItems)
+	itemGroup.GET("/image-stats/:examId", itemsService.ListImageStats)
 
 	/*
 		Game
 	*/
 	gameService := game.NewGameService(config)
 	gameGroup := r.Group("/game")
-	gameGroup.Use(AuthMiddleware())
+	// Guests can play without an account
+	gameGroup.Use(userService.PlayMiddleware())
 	gameGroup.GET("/:examId", gameService.GetItem)
+	gameGroup.GET("/question-types", gameService.ListQuestionTypes)
 	gameGroup.POST("/result", gameService.GetResult)
+	gameGroup.POST("/hint", gameService.GetHint)
+	gameGroup.POST("/sessions", gameService.CreateSession)
+	gameGroup.GET("/sessions/:sessionId", gameService.GetSession)
+	gameGroup.GET("/sessions/:sessionId/next", gameService.GetSessionQuestion)
+	gameGroup.POST("/daily/:examId", gameService.StartDailyChallenge)
+	gameGroup.GET("/mistakes/:examId", gameService.ListMistakes)
+	gameGroup.GET("/pack/:examId", gameService.GetOfflinePack)
+	gameGroup.POST("/results", gameService.SyncResults)
+
+	/*
+		Live rooms
+	*/
+	liveService := live.NewLiveService(config)
+	gameGroup.POST("/live", liveService.CreateRoom)
+	// Authenticates by itself, browsers can't send headers with WebSockets
+	r.GET("/game/live/:code/ws", liveService.JoinRoom)
+
+	/*
+		Assessments
+	*/
+	assessmentService := assessment.NewAssessmentService(config)
+	assessmentGroup := r.Group("/assessment")
+	assessmentGroup.Use(AuthMiddleware())
+	assessmentGroup.POST("/:examId", assessmentService.StartAttempt)
+	assessmentGroup.GET("/by-exam/:examId", assessmentService.ListAttempts)
+	assessmentGroup.GET("/attempts/:attemptId", assessmentService.GetAttempt)
+	assessmentGroup.PUT("/attempts/:attemptId/answers/:position", assessmentService.AnswerQuestion)
+	assessmentGroup.POST("/attempts/:attemptId/submit", assessmentService.SubmitAttempt)
+	assessmentGroup.GET("/attempts/:attemptId/report", assessmentService.GetAttemptReport)
 
 	/*
 		Files
@@ -0,0 +1,111 @@
+package rating
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"recognizer/db"
+	"sort"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	DefaultRating = 1500
+
+	// How far one answer moves the ratings
+	kFactor = 32
+
+	// Adaptive practice aims at questions the player answers right this often
+	targetSuccess = 0.7
+	// The item is picked at random out of this many closest to the target
+	adaptiveCandidates = 3
+)
+
+// Expected is the chance the player answers the item right, the usual Elo expectation
+func Expected(playerRating float64, itemRating float64) float64 {
+	return 1 / (1 + math.Pow(10, (itemRating-playerRating)/400))
+}
+
+// Update returns the ratings of the player and of the item after one answer
+func Update(playerRating float64, itemRating float64, correct bool) (float64, float64) {
+	score := 0.0
+	if correct {
+		score = 1
+	}
+
+	change := kFactor * (score - Expected(playerRating, itemRating))
+	return playerRating + change, itemRating - change
+}
+
+// TargetRating is the item rating the player answers right with the target chance
+func TargetRating(playerRating float64) float64 {
+	return playerRating + 400*math.Log10(1/targetSuccess-1)
+}
+
+// Load returns the rating of the user in the exam, a new player starts at the default rating
+func Load(tx *gorm.DB, userId uint, examId uint) (db.PlayerRating, error) {
+	player := db.PlayerRating{UserID: userId, ExamID: examId, Rating: DefaultRating}
+	err := tx.Where("user_id = ? AND exam_id = ?", userId, examId).First(&player).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return player, nil
+	}
+
+	return player, err
+}
+
+// Record updates the ratings of the user and of the item after the user answered it
+func Record(tx *gorm.DB, userId uint, item *db.Item, correct bool) error {
+	player, err := Load(tx, userId, item.ExamID)
+	if err != nil {
+		return err
+	}
+
+	playerRating, itemRating := Update(player.Rating, item.Rating, correct)
+
+	// Other players may have moved the item in the meantime, only the change is applied
+	err = tx.Model(&db.Item{}).Where("id = ?", item.ID).
+		Update("rating", gorm.Expr("rating + ?", itemRating-item.Rating)).Error
+	if err != nil {
+		return err
+	}
+	item.Rating = itemRating
+
+	player.Rating = playerRating
+	player.Answers++
+
+	if player.ID != 0 {
+		return tx.Save(&player).Error
+	}
+
+	// The first answers of a player may arrive at the same time
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "exam_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"rating", "answers", "updated_at"}),
+	}).Create(&player).Error
+}
+
+// PickAdaptive chooses an item out of the given items the user should answer right about 70% of the time
+func PickAdaptive(tx *gorm.DB, userId uint, examId uint, items []*db.Item) (*db.Item, error) {
+	if len(items) == 0 {
+		return nil, nil
+	}
+
+	player, err := Load(tx, userId, examId)
+	if err != nil {
+		return nil, err
+	}
+
+	target := TargetRating(player.Rating)
+
+	candidates := make([]*db.Item, len(items))
+	copy(candidates, items)
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return math.Abs(candidates[i].Rating-target) < math.Abs(candidates[j].Rating-target)
+	})
+
+	candidates = candidates[:min(adaptiveCandidates, len(candidates))]
+	return candidates[rand.Intn(len(candidates))], nil
+}
@@ -0,0 +1,72 @@
+package rating
+
+import (
+	"math"
+	"testing"
+)
+
+func TestExpected(t *testing.T) {
+	tests := []struct {
+		name         string
+		playerRating float64
+		itemRating   float64
+		expected     float64
+	}{
+		{"equal", 1500, 1500, 0.5},
+		{"harder item", 1500, 1900, 1.0 / 11},
+		{"easier item", 1900, 1500, 10.0 / 11},
+		{"much harder item", 1000, 1800, 1.0 / 101},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Expected(test.playerRating, test.itemRating); math.Abs(got-test.expected) > 1e-9 {
+				t.Errorf("got %v, want %v", got, test.expected)
+			}
+		})
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	tests := []struct {
+		name         string
+		playerRating float64
+		itemRating   float64
+		correct      bool
+		player       float64
+		item         float64
+	}{
+		{"equal correct", 1500, 1500, true, 1516, 1484},
+		{"equal wrong", 1500, 1500, false, 1484, 1516},
+		{"harder item correct", 1500, 1900, true, 1500 + 32*10.0/11, 1900 - 32*10.0/11},
+		{"harder item wrong", 1500, 1900, false, 1500 - 32*1.0/11, 1900 + 32*1.0/11},
+		{"easier item correct", 1900, 1500, true, 1900 + 32*1.0/11, 1500 - 32*1.0/11},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			player, item := Update(test.playerRating, test.itemRating, test.correct)
+			if math.Abs(player-test.player) > 1e-9 {
+				t.Errorf("got player %v, want %v", player, test.player)
+			}
+			if math.Abs(item-test.item) > 1e-9 {
+				t.Errorf("got item %v, want %v", item, test.item)
+			}
+			if sum := player + item; math.Abs(sum-(test.playerRating+test.itemRating)) > 1e-9 {
+				t.Errorf("got rating sum %v, want %v", sum, test.playerRating+test.itemRating)
+			}
+		})
+	}
+}
+
+func TestTargetRating(t *testing.T) {
+	for _, playerRating := range []float64{800, DefaultRating, 2100} {
+		target := TargetRating(playerRating)
+		if target >= playerRating {
+			t.Errorf("TargetRating(%v) = %v, want below the player", playerRating, target)
+		}
+		if got := Expected(playerRating, target); math.Abs(got-targetSuccess) > 1e-9 {
+			t.Errorf("Expected(%v, TargetRating(%v)) = %v, want %v", playerRating, playerRating, got, targetSuccess)
+		}
+	}
+}
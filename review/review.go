@@ -0,0 +1,193 @@
+package review
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"recognizer/db"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	defaultEaseFactor = 2.5
+	minEaseFactor     = 1.3
+
+	// SM-2 grades a recall on a 0-5 scale, we only know right or wrong
+	correctQuality = 4
+	wrongQuality   = 2
+
+	// A forgotten item is shown again within the same session
+	relearnDelay = 10 * time.Minute
+)
+
+// Schedule applies one SM-2 step to the state based on the answer given at the time now
+func Schedule(state *db.ReviewState, correct bool, now time.Time) {
+	if state.EaseFactor == 0 {
+		state.EaseFactor = defaultEaseFactor
+	}
+
+	quality := wrongQuality
+	if correct {
+		quality = correctQuality
+	}
+
+	state.EaseFactor += 0.1 - float64(5-quality)*(0.08+float64(5-quality)*0.02)
+	if state.EaseFactor < minEaseFactor {
+		state.EaseFactor = minEaseFactor
+	}
+
+	if !correct {
+		state.Repetitions = 0
+		state.Interval = 0
+		state.DueAt = now.Add(relearnDelay)
+		return
+	}
+
+	state.Repetitions++
+	switch state.Repetitions {
+	case 1:
+		state.Interval = 1
+	case 2:
+		state.Interval = 6
+	default:
+		state.Interval = int(math.Round(float64(state.Interval) * state.EaseFactor))
+	}
+	state.DueAt = now.AddDate(0, 0, state.Interval)
+}
+
+// Record updates the review state of the item after the user answered it.
+// The score point of the answer has to be stored already, so a missing state can be rebuilt from the history.
+func Record(tx *gorm.DB, userId uint, item *db.Item, correct bool, now time.Time) error {
+	var state db.ReviewState
+	err := tx.Where("user_id = ? AND item_id = ?", userId, item.ID).First(&state).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		states, err := replayHistory(tx, userId, item.ExamID, []uint{item.ID})
+		if err != nil {
+			return err
+		}
+
+		if len(states) == 0 {
+			state = db.ReviewState{UserID: userId, ItemID: item.ID, ExamID: item.ExamID}
+			Schedule(&state, correct, now)
+			return tx.Create(&state).Error
+		}
+
+		return tx.Create(&states).Error
+	}
+
+	if err != nil {
+		return err
+	}
+
+	Schedule(&state, correct, now)
+	return tx.Save(&state).Error
+}
+
+// PickDue chooses the next item the user should review out of the given items.
+// Overdue items come first, then items never seen before, then the ones due the soonest.
+func PickDue(tx *gorm.DB, userId uint, examId uint, items []*db.Item, now time.Time) (*db.Item, error) {
+	if len(items) == 0 {
+		return nil, nil
+	}
+
+	var states []db.ReviewState
+	err := tx.Where("user_id = ? AND exam_id = ?", userId, examId).Find(&states).Error
+	if err != nil {
+		return nil, err
+	}
+
+	statesByItem := make(map[uint]db.ReviewState, len(states))
+	for _, state := range states {
+		statesByItem[state.ItemID] = state
+	}
+
+	// Items answered before the scheduler existed get their state from the score history
+	var unscheduled []uint
+	for _, item := range items {
+		if _, ok := statesByItem[item.ID]; !ok {
+			unscheduled = append(unscheduled, item.ID)
+		}
+	}
+
+	if len(unscheduled) > 0 {
+		replayed, err := replayHistory(tx, userId, examId, unscheduled)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(replayed) > 0 {
+			if err := tx.Create(&replayed).Error; err != nil {
+				return nil, err
+			}
+		}
+
+		for _, state := range replayed {
+			statesByItem[state.ItemID] = state
+		}
+	}
+
+	var mostOverdue, soonestDue *db.Item
+	var mostOverdueAt, soonestDueAt time.Time
+	var newItems []*db.Item
+
+	for _, item := range items {
+		state, ok := statesByItem[item.ID]
+		if !ok {
+			newItems = append(newItems, item)
+			continue
+		}
+
+		if !state.DueAt.After(now) && (mostOverdue == nil || state.DueAt.Before(mostOverdueAt)) {
+			mostOverdue = item
+			mostOverdueAt = state.DueAt
+		}
+
+		if soonestDue == nil || state.DueAt.Before(soonestDueAt) {
+			soonestDue = item
+			soonestDueAt = state.DueAt
+		}
+	}
+
+	if mostOverdue != nil {
+		return mostOverdue, nil
+	}
+
+	if len(newItems) > 0 {
+		return newItems[rand.Intn(len(newItems))], nil
+	}
+
+	return soonestDue, nil
+}
+
+// replayHistory builds review states for the items by running the scheduler over the stored score points
+func replayHistory(tx *gorm.DB, userId uint, examId uint, itemIds []uint) ([]db.ReviewState, error) {
+	var scorePoints []db.ScorePoint
+	err := tx.Where("user_id = ? AND exam_id = ? AND item_id IN ?", userId, examId, itemIds).
+		Order("created_at").
+		Find(&scorePoints).Error
+	if err != nil {
+		return nil, err
+	}
+
+	statesByItem := map[uint]*db.ReviewState{}
+	var order []uint
+	for _, scorePoint := range scorePoints {
+		state, ok := statesByItem[scorePoint.ItemID]
+		if !ok {
+			state = &db.ReviewState{UserID: userId, ItemID: scorePoint.ItemID, ExamID: examId}
+			statesByItem[scorePoint.ItemID] = state
+			order = append(order, scorePoint.ItemID)
+		}
+		Schedule(state, scorePoint.Correct, scorePoint.CreatedAt)
+	}
+
+	states := make([]db.ReviewState, 0, len(order))
+	for _, itemId := range order {
+		states = append(states, *statesByItem[itemId])
+	}
+
+	return states, nil
+}
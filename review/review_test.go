@@ -0,0 +1,52 @@
+package review
+
+import (
+	"math"
+	"recognizer/db"
+	"testing"
+	"time"
+)
+
+func TestSchedule(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		answers     []bool
+		repetitions int
+		interval    int
+		easeFactor  float64
+		dueAt       time.Time
+	}{
+		{"first correct", []bool{true}, 1, 1, 2.5, now.AddDate(0, 0, 1)},
+		{"second correct", []bool{true, true}, 2, 6, 2.5, now.AddDate(0, 0, 6)},
+		{"third correct", []bool{true, true, true}, 3, 15, 2.5, now.AddDate(0, 0, 15)},
+		{"first wrong", []bool{false}, 0, 0, 2.18, now.Add(relearnDelay)},
+		{"wrong resets", []bool{true, true, true, false}, 0, 0, 2.18, now.Add(relearnDelay)},
+		{"correct after wrong", []bool{true, true, false, true}, 1, 1, 2.18, now.AddDate(0, 0, 1)},
+		{"lower ease stretches less", []bool{false, true, true, true}, 3, 13, 2.18, now.AddDate(0, 0, 13)},
+		{"ease floor", []bool{false, false, false, false, false}, 0, 0, minEaseFactor, now.Add(relearnDelay)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			state := db.ReviewState{}
+			for _, correct := range test.answers {
+				Schedule(&state, correct, now)
+			}
+
+			if state.Repetitions != test.repetitions {
+				t.Errorf("got %d repetitions, want %d", state.Repetitions, test.repetitions)
+			}
+			if state.Interval != test.interval {
+				t.Errorf("got interval %d, want %d", state.Interval, test.interval)
+			}
+			if math.Abs(state.EaseFactor-test.easeFactor) > 1e-9 {
+				t.Errorf("got ease factor %v, want %v", state.EaseFactor, test.easeFactor)
+			}
+			if !state.DueAt.Equal(test.dueAt) {
+				t.Errorf("got due at %v, want %v", state.DueAt, test.dueAt)
+			}
+		})
+	}
+}
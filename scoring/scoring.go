@@ -0,0 +1,105 @@
+package scoring
+
+import (
+	"errors"
+	"math"
+	"recognizer/db"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Exams without a time limit measure speed against this time
+const defaultSpeedWindowMs = 10000
+
+// Answer is what the points of an answer depend on
+type Answer struct {
+	Correct    bool
+	ResponseMs int64
+	Hints      int
+}
+
+// Points are what the answer earns under the current rules of the exam, streak is the number of correct answers in a row before it
+func Points(exam *db.Exam, answer Answer, streak int) int {
+	rules := exam.Scoring
+	if !answer.Correct {
+		return -rules.WrongPenalty
+	}
+
+	points := rules.CorrectPoints - answer.Hints*rules.HintPenalty
+
+	// Fast answers earn up to the speed bonus, the bonus runs out at the time limit
+	if rules.SpeedBonus > 0 && answer.ResponseMs > 0 {
+		speedWindowMs := int64(defaultSpeedWindowMs)
+		if exam.QuestionTimeLimit > 0 {
+			speedWindowMs = int64(exam.QuestionTimeLimit) * 1000
+		}
+		points += int(math.Round(math.Max(0, 1-float64(answer.ResponseMs)/float64(speedWindowMs)) * float64(rules.SpeedBonus)))
+	}
+
+	if rules.StreakBonus > 0 {
+		streakBonus := streak * rules.StreakBonus
+		if rules.MaxStreakBonus > 0 {
+			streakBonus = min(streakBonus, rules.MaxStreakBonus)
+		}
+		points += streakBonus
+	}
+
+	return points
+}
+
+// Streak counts the correct answers the user gave in the exam in a row before the time
+func Streak(tx *gorm.DB, userId uint, examId uint, before time.Time) (int, error) {
+	lastWrong := tx.Model(&db.ScorePoint{}).
+		Select("MAX(created_at)").
+		Where("user_id = ? AND exam_id = ? AND NOT correct AND created_at < ?", userId, examId, before)
+
+	var streak int64
+	err := tx.Model(&db.ScorePoint{}).
+		Where("user_id = ? AND exam_id = ? AND correct AND created_at < ?", userId, examId, before).
+		Where("created_at > COALESCE((?), '-infinity')", lastWrong).
+		Count(&streak).Error
+
+	return int(streak), err
+}
+
+// Score works out the points of an answer the user gave at the time, the streak is only looked up when the rules reward it
+func Score(tx *gorm.DB, exam *db.Exam, userId uint, answer Answer, at time.Time) (int, error) {
+	streak := 0
+	if answer.Correct && exam.Scoring.StreakBonus > 0 {
+		var err error
+		if streak, err = Streak(tx, userId, exam.ID, at); err != nil {
+			return 0, err
+		}
+	}
+
+	return Points(exam, answer, streak), nil
+}
+
+// SetRules makes the rules the current ones of the exam as a new version, answers given before keep their points
+func SetRules(tx *gorm.DB, exam *db.Exam, rules db.ScoringRules) error {
+	if exam.ScoringVersion > 0 && exam.Scoring == rules {
+		return nil
+	}
+
+	policy := db.ScoringPolicy{ExamID: exam.ID, Version: exam.ScoringVersion + 1, Rules: rules}
+	if err := tx.Create(&policy).Error; err != nil {
+		return err
+	}
+
+	exam.Scoring = rules
+	exam.ScoringVersion = policy.Version
+	return tx.Model(exam).Select("scoring", "scoring_version").Updates(exam).Error
+}
+
+// RulesAt returns the rules the exam had at the time
+func RulesAt(tx *gorm.DB, exam *db.Exam, at time.Time) (db.ScoringRules, error) {
+	var policy db.ScoringPolicy
+	err := tx.Where("exam_id = ? AND created_at <= ?", exam.ID, at).Order("version DESC").First(&policy).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return exam.Scoring, nil
+	}
+
+	return policy.Rules, err
+}
@@ -0,0 +1,50 @@
+package scoring
+
+import (
+	"recognizer/db"
+	"testing"
+)
+
+func TestPoints(t *testing.T) {
+	rules := db.ScoringRules{
+		CorrectPoints:  10,
+		WrongPenalty:   5,
+		SpeedBonus:     8,
+		StreakBonus:    2,
+		MaxStreakBonus: 6,
+		HintPenalty:    3,
+	}
+	uncapped := rules
+	uncapped.MaxStreakBonus = 0
+
+	tests := []struct {
+		name   string
+		exam   db.Exam
+		answer Answer
+		streak int
+		points int
+	}{
+		{"default correct", db.Exam{Scoring: db.DefaultScoringRules}, Answer{Correct: true, ResponseMs: 1000}, 3, 10},
+		{"default wrong", db.Exam{Scoring: db.DefaultScoringRules}, Answer{ResponseMs: 1000}, 3, -5},
+		{"default hints", db.Exam{Scoring: db.DefaultScoringRules}, Answer{Correct: true, Hints: 2}, 0, 4},
+		{"wrong ignores bonuses", db.Exam{Scoring: rules}, Answer{ResponseMs: 1, Hints: 1}, 5, -5},
+		{"no response time", db.Exam{Scoring: rules}, Answer{Correct: true}, 0, 10},
+		{"speed without time limit", db.Exam{Scoring: rules}, Answer{Correct: true, ResponseMs: 2500}, 0, 16},
+		{"slow without time limit", db.Exam{Scoring: rules}, Answer{Correct: true, ResponseMs: 12000}, 0, 10},
+		{"speed with time limit", db.Exam{Scoring: rules, QuestionTimeLimit: 20}, Answer{Correct: true, ResponseMs: 5000}, 0, 16},
+		{"speed rounds", db.Exam{Scoring: rules, QuestionTimeLimit: 20}, Answer{Correct: true, ResponseMs: 11000}, 0, 14},
+		{"hints and speed", db.Exam{Scoring: rules, QuestionTimeLimit: 20}, Answer{Correct: true, ResponseMs: 5000, Hints: 1}, 0, 13},
+		{"streak", db.Exam{Scoring: rules}, Answer{Correct: true}, 2, 14},
+		{"streak cap", db.Exam{Scoring: rules}, Answer{Correct: true}, 5, 16},
+		{"uncapped streak", db.Exam{Scoring: uncapped}, Answer{Correct: true}, 5, 20},
+		{"hints below zero", db.Exam{Scoring: rules}, Answer{Correct: true, Hints: 4}, 0, -2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Points(&test.exam, test.answer, test.streak); got != test.points {
+				t.Errorf("got %d, want %d", got, test.points)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package types
+
+import "time"
+
+type AnswerAttemptQuestion struct {
+	// Empty clears the answer
+	Answer string `json:"answer"`
+}
+
+type AttemptQuestionView struct {
+	Position int      `json:"position"`
+	Image    string   `json:"image"`
+	Answers  []string `json:"answers"`
+	Answer   string   `json:"answer"`
+}
+
+// AttemptView is what the player sees of an attempt, the result only once it is locked
+type AttemptView struct {
+	AttemptId   uint                  `json:"attemptId"`
+	ExamId      uint                  `json:"examId"`
+	StartedAt   time.Time             `json:"startedAt"`
+	DeadlineAt  time.Time             `json:"deadlineAt"`
+	SubmittedAt *time.Time            `json:"submittedAt"`
+	Locked      bool                  `json:"locked"`
+	TimedOut    bool                  `json:"timedOut"`
+	Questions   []AttemptQuestionView `json:"questions"`
+	Result      *AttemptResult        `json:"result,omitempty"`
+}
+
+type AttemptResult struct {
+	Correct int `json:"correct"`
+	Total   int `json:"total"`
+	// Percentage of correct answers
+	Score int `json:"score"`
+}
+
+type AttemptSummary struct {
+	AttemptId   uint       `json:"attemptId"`
+	UserId      uint       `json:"userId"`
+	Username    string     `json:"username"`
+	StartedAt   time.Time  `json:"startedAt"`
+	SubmittedAt *time.Time `json:"submittedAt"`
+	TimedOut    bool       `json:"timedOut"`
+	Correct     int        `json:"correct"`
+	Total       int        `json:"total"`
+	Score       int        `json:"score"`
+}
+
+type AttemptReportQuestion struct {
+	Position      int        `json:"position"`
+	ItemId        uint       `json:"itemId"`
+	Image         string     `json:"image"`
+	Answers       []string   `json:"answers"`
+	CorrectAnswer string     `json:"correctAnswer"`
+	Answer        string     `json:"answer"`
+	AnsweredAt    *time.Time `json:"answeredAt"`
+	Correct       bool       `json:"correct"`
+}
+
+type AttemptReport struct {
+	AttemptSummary
+	DeadlineAt time.Time               `json:"deadlineAt"`
+	Questions  []AttemptReportQuestion `json:"questions"`
+}
@@ -1,5 +1,104 @@
 package types
 
+// Who can see and play an exam
+const (
+	// Only the owner
+	VisibilityPrivate = "private"
+	// Whoever opened one of its share links
+	VisibilityUnlisted = "unlisted"
+	// Everyone, the exam is listed in the catalog
+	VisibilityPublic = "public"
+)
+
+// Roles of the members of an exam, each one can do everything the ones before it can
+const (
+	// Plays the exam whatever its visibility
+	RoleViewer = "viewer"
+	// Changes the groups and the items
+	RoleEditor = "editor"
+	// Changes the exam itself and manages its members
+	RoleOwner = "owner"
+)
+
 type CreateExamDto struct {
 	Name string `json:"name" binding:"required"`
 }
+
+type CloneExamDto struct {
+	// Name of the clone, the name of the source with a suffix when empty
+	Name string `json:"name"`
+}
+
+type UpdateExamDto struct {
+	Name string `json:"name" binding:"required"`
+	// Typed answers within this many edits of the correct one are accepted
+	MaxTypos         *int  `json:"maxTypos" binding:"omitempty,min=0"`
+	StrictCase       *bool `json:"strictCase"`
+	StrictDiacritics *bool `json:"strictDiacritics"`
+	// Seconds to answer a question, zero turns the limit off
+	QuestionTimeLimit *int `json:"questionTimeLimit" binding:"omitempty,min=0,max=600"`
+	AnswerCount       *int `json:"answerCount" binding:"omitempty,min=2,max=8"`
+	// Replaces the weights of the question types when set
+	QuestionTypes map[string]int `json:"questionTypes" binding:"omitempty,dive,min=0,max=100"`
+	// Questions and minutes of a formal assessment
+	AssessmentSize      *int `json:"assessmentSize" binding:"omitempty,min=1,max=200"`
+	AssessmentTimeLimit *int `json:"assessmentTimeLimit" binding:"omitempty,min=1,max=600"`
+	// Replaces the scoring rules when set, answers given before keep their points
+	Scoring    *ScoringRulesDto `json:"scoring"`
+	Visibility *string          `json:"visibility" binding:"omitempty,oneof=private unlisted public"`
+}
+
+type ScoringRulesDto struct {
+	CorrectPoints  int  `json:"correctPoints" binding:"min=0,max=1000"`
+	WrongPenalty   int  `json:"wrongPenalty" binding:"min=0,max=1000"`
+	BaseScore      int  `json:"baseScore" binding:"min=0,max=100000"`
+	SpeedBonus     int  `json:"speedBonus" binding:"min=0,max=1000"`
+	StreakBonus    int  `json:"streakBonus" binding:"min=0,max=1000"`
+	MaxStreakBonus int  `json:"maxStreakBonus" binding:"min=0,max=10000"`
+	HintPenalty    int  `json:"hintPenalty" binding:"min=0,max=1000"`
+	FloorAtZero    bool `json:"floorAtZero"`
+}
+
+// Windows a leaderboard can be limited to, in UTC calendar periods
+const (
+	LeaderboardAllTime = "all"
+	LeaderboardMonth   = "month"
+	LeaderboardWeek    = "week"
+	LeaderboardDay     = "day"
+)
+
+type LeaderboardQuery struct {
+	Window string `form:"window" binding:"omitempty,oneof=all month week day"`
+	Limit  int    `form:"limit" binding:"omitempty,min=1,max=100"`
+	Offset int    `form:"offset" binding:"omitempty,min=0"`
+	// Continues after the last player of the previous page, can't be combined with an offset
+	Cursor string `form:"cursor"`
+	// Any day of the month, week or day to show, the current one when empty
+	Date string `form:"date"`
+}
+
+type InviteMemberDto struct {
+	Username string `json:"username" binding:"required"`
+	Role     string `json:"role" binding:"required,oneof=viewer editor owner"`
+}
+
+type UpdateMemberDto struct {
+	Role string `json:"role" binding:"required,oneof=viewer editor owner"`
+}
+
+type ExamMemberItem struct {
+	ID       uint   `json:"id"`
+	UserID   uint   `json:"userId"`
+	Username string `json:"username"`
+	Role     string `json:"role"`
+	// False while the invitation is pending
+	Accepted bool `json:"accepted"`
+}
+
+type ExamInvitation struct {
+	ID        uint   `json:"id"`
+	ExamID    uint   `json:"examId"`
+	ExamName  string `json:"examName"`
+	Role      string `json:"role"`
+	InvitedBy string `json:"invitedBy"`
+}
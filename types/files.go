@@ -0,0 +1,25 @@
+package types
+
+// Kinds of media an item can be recognized by
+const (
+	MediaImage = "image"
+	MediaAudio = "audio"
+	MediaVideo = "video"
+)
+
+// GameMedia tells the client how to play the media of a question
+type GameMedia struct {
+	Type        string `json:"type"`
+	ContentType string `json:"contentType,omitempty"`
+	// Zero for images and for files uploaded before their duration was known
+	DurationMs int64 `json:"durationMs,omitempty"`
+}
+
+type UploadedFile struct {
+	// Storage key of the file, kept as url for older clients
+	Url         string `json:"url"`
+	MediaType   string `json:"mediaType"`
+	ContentType string `json:"contentType"`
+	Size        int64  `json:"size"`
+	DurationMs  int64  `json:"durationMs,omitempty"`
+}
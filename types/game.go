@@ -1,12 +1,122 @@
 package types
 
+import "time"
+
+const (
+	QuestionChoice = "choice"
+	QuestionTyped  = "typed"
+	// Shows the name and asks for the matching image
+	QuestionReverse = "reverse"
+	// Shows the image with a name to accept or reject
+	QuestionTrueFalse = "truefalse"
+	// Shows several images to be given their names
+	QuestionMatching = "matching"
+)
+
+// How closely an answer matched the correct one
+const (
+	MatchExact = "exact"
+	MatchNear  = "near"
+	MatchWrong = "wrong"
+)
+
 type GetResult struct {
 	ItemId uint   `json:"itemId"`
 	Answer string `json:"answer"`
+	// The item picked in a reverse question
+	AnswerItemId uint `json:"answerItemId"`
+	// Names given to the options of a matching question, in their order
+	Matches []string `json:"matches"`
+	Ticket  string   `json:"ticket" binding:"required"`
+	// Set when answering a question of a game session
+	SessionId *uint `json:"sessionId"`
+}
+
+// Hints a player can ask for during a question
+const (
+	HintGroup = "group"
+	// Removes two wrong options
+	HintFiftyFifty = "fifty"
+	HintLetters    = "letters"
+)
+
+type GetHint struct {
+	Ticket string `json:"ticket" binding:"required"`
+	Kind   string `json:"kind" binding:"required,oneof=group fifty letters"`
+}
+
+type HintResponse struct {
+	Kind  string `json:"kind"`
+	Group string `json:"group,omitempty"`
+	// Wrong answers of a choice question, wrong items of a reverse question
+	Removed        []string `json:"removed,omitempty"`
+	RemovedItemIds []uint   `json:"removedItemIds,omitempty"`
+	// First letter of each word, the others replaced by underscores
+	Letters string `json:"letters,omitempty"`
+	// Hints used on the question so far
+	Used int `json:"used"`
+}
+
+type GameOption struct {
+	ItemId uint       `json:"itemId"`
+	Image  string     `json:"image"`
+	Media  *GameMedia `json:"media,omitempty"`
 }
 
 type GameResponse struct {
-	ItemId  uint     `json:"itemId"`
-	Image   string   `json:"image"`
-	Answers []string `json:"answers"`
+	Type string `json:"type"`
+	// Zero for reverse questions, where it would give the answer away
+	ItemId uint   `json:"itemId"`
+	Image  string `json:"image"`
+	// How to play the image, which can be a sound or a video too
+	Media   *GameMedia `json:"media,omitempty"`
+	Answers []string   `json:"answers"`
+	// Name and image options of reverse questions, the name to judge in true or false questions
+	Name    string       `json:"name,omitempty"`
+	Options []GameOption `json:"options,omitempty"`
+	// Seconds to answer, zero means no limit
+	TimeLimit int `json:"timeLimit"`
+	// Has to be sent back with the answer
+	Ticket string `json:"ticket"`
+}
+
+// Days of the daily challenge follow UTC for everyone
+const DailyDateFormat = "2006-01-02"
+
+type CreateGameSession struct {
+	ExamId  uint  `json:"examId" binding:"required"`
+	Count   int   `json:"count" binding:"required,min=1"`
+	GroupId *uint `json:"groupId"`
+}
+
+type GameSessionMissedItem struct {
+	ItemId uint   `json:"itemId"`
+	Name   string `json:"name"`
+	Image  string `json:"image"`
+	Answer string `json:"answer"`
+}
+
+type GameSessionReport struct {
+	SessionId   uint                    `json:"sessionId"`
+	ExamId      uint                    `json:"examId"`
+	GroupId     *uint                   `json:"groupId"`
+	Finished    bool                    `json:"finished"`
+	Total       int                     `json:"total"`
+	Answered    int                     `json:"answered"`
+	Correct     int                     `json:"correct"`
+	Wrong       int                     `json:"wrong"`
+	Percentage  int                     `json:"percentage"`
+	TimeTakenMs int64                   `json:"timeTakenMs"`
+	Missed      []GameSessionMissedItem `json:"missed"`
+	// Sum of the points the answers got under the scoring rules of the exam
+	Points int `json:"points"`
+}
+
+type MistakeItem struct {
+	ItemId     uint      `json:"itemId"`
+	Name       string    `json:"name"`
+	Image      string    `json:"image"`
+	GroupId    uint      `json:"groupId"`
+	WrongCount int       `json:"wrongCount"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
 }
@@ -1,14 +1,37 @@
 package types
 
 type CreateItem struct {
-	Name    string `json:"name"`
-	Image   string `json:"image"`
-	ExamId  uint   `json:"examId"`
-	GroupId uint   `json:"groupId"`
+	Name    string   `json:"name"`
+	Image   string   `json:"image"`
+	Aliases []string `json:"aliases"`
+	ExamId  uint     `json:"examId"`
+	GroupId uint     `json:"groupId"`
+	// In display order, the first one replaces Image
+	Images []ItemImageDto `json:"images" binding:"dive"`
 }
 
 type UpdateItem struct {
-	Name    string `json:"name"`
-	Image   string `json:"image"`
-	GroupId uint   `json:"groupId"`
+	Name    string   `json:"name"`
+	Image   string   `json:"image"`
+	Aliases []string `json:"aliases"`
+	GroupId uint     `json:"groupId"`
+	// Replaces the image list when set, images sent with their id keep their accuracy
+	Images *[]ItemImageDto `json:"images" binding:"omitempty,dive"`
+}
+
+type ItemImageDto struct {
+	Id      uint   `json:"id"`
+	Image   string `json:"image" binding:"required"`
+	Caption string `json:"caption"`
+}
+
+type ImageStats struct {
+	ImageId  uint   `json:"imageId"`
+	ItemId   uint   `json:"itemId"`
+	Name     string `json:"name"`
+	Image    string `json:"image"`
+	Caption  string `json:"caption"`
+	Answers  int    `json:"answers"`
+	Correct  int    `json:"correct"`
+	Accuracy int    `json:"accuracy"`
 }
@@ -0,0 +1,56 @@
+package types
+
+import "time"
+
+// Messages sent by the clients of a live room
+const (
+	LiveNext   = "next"
+	LiveEnd    = "end"
+	LiveAnswer = "answer"
+)
+
+// Events pushed to the clients of a live room
+const (
+	LivePlayers     = "players"
+	LiveQuestion    = "question"
+	LiveAnswered    = "answered"
+	LiveRoundResult = "roundResult"
+	LiveFinished    = "finished"
+	LiveError       = "error"
+)
+
+type CreateLiveRoom struct {
+	ExamId       uint `json:"examId" binding:"required"`
+	RoundSeconds int  `json:"roundSeconds" binding:"omitempty,min=5,max=120"`
+}
+
+type LiveRoomResponse struct {
+	Code         string `json:"code"`
+	ExamId       uint   `json:"examId"`
+	RoundSeconds int    `json:"roundSeconds"`
+}
+
+type LiveMessage struct {
+	Type   string `json:"type"`
+	Answer string `json:"answer"`
+}
+
+type LiveLeaderboardItem struct {
+	UserId   uint   `json:"userId"`
+	Username string `json:"username"`
+	Points   int    `json:"points"`
+	Correct  int    `json:"correct"`
+	Rank     int    `json:"rank"`
+}
+
+type LiveEvent struct {
+	Type        string                `json:"type"`
+	Round       int                   `json:"round,omitempty"`
+	Question    *GameResponse         `json:"question,omitempty"`
+	EndsAt      *time.Time            `json:"endsAt,omitempty"`
+	Answer      string                `json:"answer,omitempty"`
+	Correct     *bool                 `json:"correct,omitempty"`
+	Players     []string              `json:"players,omitempty"`
+	Leaderboard []LiveLeaderboardItem `json:"leaderboard,omitempty"`
+	Error       string                `json:"error,omitempty"`
+}
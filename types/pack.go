@@ -0,0 +1,75 @@
+package types
+
+import "time"
+
+// Bumped when the layout of the offline pack changes
+const OfflinePackFormat = 1
+
+// OfflinePack is everything a client needs to practice an exam without connectivity
+type OfflinePack struct {
+	Format int    `json:"format"`
+	ExamId uint   `json:"examId"`
+	Name   string `json:"name"`
+	// Changes whenever the content of the pack changes
+	Version           string `json:"version"`
+	MaxTypos          int    `json:"maxTypos"`
+	StrictCase        bool   `json:"strictCase"`
+	StrictDiacritics  bool   `json:"strictDiacritics"`
+	QuestionTimeLimit int    `json:"questionTimeLimit"`
+	AnswerCount       int    `json:"answerCount"`
+	// Weights of the question types, results of types without weight are rejected unless there are no weights
+	QuestionTypes map[string]int `json:"questionTypes"`
+	Groups        []PackGroup    `json:"groups"`
+	Items         []PackItem     `json:"items"`
+	GeneratedAt   time.Time      `json:"generatedAt"`
+	// Signed by the server, has to be sent back with the synced results
+	Token string `json:"token"`
+}
+
+type PackGroup struct {
+	Id   uint   `json:"id"`
+	Name string `json:"name"`
+}
+
+type PackItem struct {
+	Id      uint     `json:"id"`
+	Name    string   `json:"name"`
+	Image   string   `json:"image"`
+	Aliases []string `json:"aliases"`
+	GroupId uint     `json:"groupId"`
+	// All images of the item in display order
+	Images    []string `json:"images"`
+	MediaType string   `json:"mediaType"`
+}
+
+type SyncResults struct {
+	Token   string          `json:"token" binding:"required"`
+	Results []OfflineResult `json:"results" binding:"required,max=500,dive"`
+}
+
+// OfflineResult is an answer recorded by the client while offline
+type OfflineResult struct {
+	// Generated by the client, a result sent twice is only stored once
+	IdempotencyKey string `json:"idempotencyKey" binding:"required,max=64"`
+	Type           string `json:"type" binding:"required,oneof=choice typed reverse"`
+	ItemId         uint   `json:"itemId" binding:"required"`
+	Answer         string `json:"answer"`
+	// The item picked in a reverse question
+	AnswerItemId uint      `json:"answerItemId"`
+	AnsweredAt   time.Time `json:"answeredAt" binding:"required"`
+	ResponseMs   int64     `json:"responseMs" binding:"min=0"`
+}
+
+// Outcomes of a synced result
+const (
+	SyncCreated   = "created"
+	SyncDuplicate = "duplicate"
+	SyncRejected  = "rejected"
+)
+
+type SyncResultStatus struct {
+	IdempotencyKey string `json:"idempotencyKey"`
+	Status         string `json:"status"`
+	Correct        bool   `json:"correct"`
+	Error          string `json:"error,omitempty"`
+}
@@ -3,4 +3,6 @@ package types
 type CreateUserDto struct {
 	Username string `json:"username" binding:"required"`
 	Password string `json:"password" binding:"required"`
+	// History played as a guest is moved to the account
+	GuestToken string `json:"guestToken"`
 }
@@ -0,0 +1,178 @@
+package user
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"recognizer/db"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// Guests have to sign up within this time to keep their history
+	guestTokenLifetime = 30 * 24 * time.Hour
+	guestPrefix        = "guest-"
+)
+
+var errGuestToken = errors.New("Guest tokens can only be used to play")
+
+func createGuestToken(userId uint) (string, error) {
+	claims := jwt.MapClaims{}
+	claims["guest"] = true
+	claims["user_id"] = userId
+	claims["exp"] = time.Now().Add(guestTokenLifetime).Unix()
+
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+}
+
+// parseAnyToken parses both account and guest tokens
+func parseAnyToken(tokenString string) (uint, bool, error) {
+	claims := &jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(secret), nil
+	})
+
+	if err != nil {
+		return 0, false, err
+	}
+
+	userId, ok := (*claims)["user_id"].(float64)
+	if !ok {
+		return 0, false, errors.New("Invalid token")
+	}
+	guest, _ := (*claims)["guest"].(bool)
+
+	return uint(userId), guest, nil
+}
+
+// CreateGuest starts an anonymous account that can play until it signs up
+func (service *Service) CreateGuest(c *gin.Context) {
+	guest := db.User{
+		Username: guestPrefix + strings.ReplaceAll(uuid.New().String(), "-", "")[:12],
+		Guest:    true,
+	}
+
+	if err := service.DB.Create(&guest).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error creating guest"})
+		return
+	}
+
+	token, err := createGuestToken(guest.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error creating token"})
+		return
+	}
+
+	c.Writer.Header().Set("Authorization", token)
+	c.JSON(200, guest.ToSimpleUser())
+}
+
+// PlayMiddleware lets both accounts and guests through, guests only as long as they weren't merged into an account
+func (service *Service) PlayMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId, guest, err := service.ParsePlayToken(c.GetHeader("Authorization"))
+		if err != nil {
+			c.JSON(403, "Invalid token")
+			c.Abort()
+			return
+		}
+
+		c.Set("userId", userId)
+		c.Set("guest", guest)
+		c.Next()
+	}
+}
+
+// ParsePlayToken parses an account or a guest token, the guest still has to exist
+func (service *Service) ParsePlayToken(tokenString string) (uint, bool, error) {
+	userId, guest, err := parseAnyToken(tokenString)
+	if err != nil || !guest {
+		return userId, guest, err
+	}
+
+	var foundGuest db.User
+	if err := service.DB.Where("guest = ?", true).First(&foundGuest, userId).Error; err != nil {
+		return 0, false, err
+	}
+
+	return userId, true, nil
+}
+
+// authResponse is the user who logged in or signed up.
+// Merged is only set when a guest token was sent, false means the history of the guest wasn't moved and the token can be sent again.
+type authResponse struct {
+	db.SimpleUser
+	Merged *bool `json:"merged,omitempty"`
+}
+
+// mergeGuestInto merges the guest of the token into the user when there is one and builds the response
+func (service *Service) mergeGuestInto(guestToken string, user db.User) authResponse {
+	response := authResponse{SimpleUser: user.ToSimpleUser()}
+	if guestToken == "" {
+		return response
+	}
+
+	merged := true
+	if err := service.mergeGuest(guestToken, user.ID); err != nil {
+		fmt.Println(err.Error())
+		merged = false
+	}
+	response.Merged = &merged
+
+	return response
+}
+
+// mergeGuest moves the history of the guest to the account and removes the guest.
+// Where both have a record that can only exist once, like a review schedule or a daily challenge, the account keeps its own.
+// Guests can't be invited to exams, so there are no memberships to move.
+func (service *Service) mergeGuest(guestToken string, userId uint) error {
+	guestId, guest, err := parseAnyToken(guestToken)
+	if err != nil || !guest || guestId == userId {
+		return errors.New("Invalid guest token")
+	}
+
+	return service.DB.Transaction(func(tx *gorm.DB) error {
+		var foundGuest db.User
+		if err := tx.Where("guest = ?", true).First(&foundGuest, guestId).Error; err != nil {
+			return err
+		}
+
+		steps := []struct {
+			sql  string
+			args []interface{}
+		}{
+			// Results synced from an offline pack by both would break the idempotency of the sync
+			{"DELETE FROM score_points WHERE user_id = ? AND idempotency_key IN (SELECT idempotency_key FROM score_points WHERE user_id = ? AND idempotency_key IS NOT NULL)", []interface{}{guestId, userId}},
+			// A daily challenge the account played too stays with the guest, the answers given in it go with it
+			{"UPDATE game_sessions SET user_id = ? WHERE user_id = ? AND (challenge_id IS NULL OR challenge_id NOT IN (SELECT challenge_id FROM game_sessions WHERE user_id = ? AND challenge_id IS NOT NULL))", []interface{}{userId, guestId, userId}},
+			{"DELETE FROM score_points WHERE user_id = ? AND session_id IN (SELECT id FROM game_sessions WHERE user_id = ?)", []interface{}{guestId, guestId}},
+			{"UPDATE score_points SET user_id = ? WHERE user_id = ?", []interface{}{userId, guestId}},
+			{"DELETE FROM review_states WHERE user_id = ? AND item_id IN (SELECT item_id FROM review_states WHERE user_id = ?)", []interface{}{guestId, userId}},
+			{"UPDATE review_states SET user_id = ? WHERE user_id = ?", []interface{}{userId, guestId}},
+			{"DELETE FROM player_ratings WHERE user_id = ? AND exam_id IN (SELECT exam_id FROM player_ratings WHERE user_id = ?)", []interface{}{guestId, userId}},
+			{"UPDATE player_ratings SET user_id = ? WHERE user_id = ?", []interface{}{userId, guestId}},
+			{"UPDATE used_tickets SET user_id = ? WHERE user_id = ?", []interface{}{userId, guestId}},
+			{"UPDATE used_hints SET user_id = ? WHERE user_id = ?", []interface{}{userId, guestId}},
+			{"UPDATE attempts SET user_id = ? WHERE user_id = ?", []interface{}{userId, guestId}},
+			{"DELETE FROM exam_shares WHERE user_id = ? AND share_link_id IN (SELECT share_link_id FROM exam_shares WHERE user_id = ?)", []interface{}{guestId, userId}},
+			{"UPDATE exam_shares SET user_id = ? WHERE user_id = ?", []interface{}{userId, guestId}},
+		}
+
+		for _, step := range steps {
+			if err := tx.Exec(step.sql, step.args...).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Delete(&foundGuest).Error
+	})
+}
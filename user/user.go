@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"recognizer/db"
 	"recognizer/types"
+	"strings"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
@@ -61,6 +62,11 @@ func ParseToken(tokenString string) (uint, error) {
 	if err != nil {
 		return 0, err
 	}
+
+	// Guests only get through PlayMiddleware
+	if guest, _ := (*claims)["guest"].(bool); guest {
+		return 0, errGuestToken
+	}
 	userId := uint((*claims)["user_id"].(float64))
 
 	return userId, nil
@@ -94,6 +100,9 @@ func(service *Service) LoginUser(c *gin.Context){
 		return
 	}
 
+	// Whatever was played as a guest before logging in belongs to the account now
+	response := service.mergeGuestInto(request.GuestToken, foundUser)
+
 	token, tokenErr := CreateToken(foundUser.ID)
 
 	if tokenErr != nil {
@@ -103,7 +112,7 @@ func(service *Service) LoginUser(c *gin.Context){
 
 	c.Writer.Header().Set("Authorization", token)
 
-	c.JSON(200, foundUser.ToSimpleUser())
+	c.JSON(200, response)
 }
 
 func(service *Service) CreateUser(c * gin.Context){
@@ -113,6 +122,12 @@ func(service *Service) CreateUser(c * gin.Context){
 		return
 	}
 
+	// Guests are named with the prefix
+	if strings.HasPrefix(request.Username, guestPrefix) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Username can't start with " + guestPrefix})
+		return
+	}
+
 	// First we have to check whether user with username already exists
 	var foundUsers []db.User
 	service.DB.Where("username = ?", request.Username).Find(&foundUsers).Limit(1)
@@ -136,6 +151,8 @@ func(service *Service) CreateUser(c * gin.Context){
 
 	service.DB.Create(&user)
 
+	response := service.mergeGuestInto(request.GuestToken, user)
+
 	token, tokenErr := CreateToken(user.ID)
 	if tokenErr != nil {
 		c.JSON(403, "Error creating token")
@@ -143,5 +160,5 @@ func(service *Service) CreateUser(c * gin.Context){
 	}
 
 	c.Writer.Header().Set("Authorization", token)
-	c.JSON(200, user.ToSimpleUser())
+	c.JSON(200, response)
 }